@@ -1,105 +1,129 @@
 package cameradar
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v5"
 	"github.com/bluenviron/gortsplib/v5/pkg/base"
 	"github.com/bluenviron/gortsplib/v5/pkg/description"
-	"github.com/bluenviron/gortsplib/v5/pkg/format"
-	"github.com/bluenviron/gortsplib/v5/pkg/format/rtph264"
-	"github.com/bluenviron/gortsplib/v5/pkg/headers"
-	"github.com/pion/rtp"
 )
 
-// Authentication types.
-// const (
-// 	authNone   = 0
-// 	authBasic  = 1
-// 	authDigest = 2
-// )
-
-type AuthInfo struct {
-	Type      string
-	Realm     string
-	Nonce     string
-	Opaque    string
-	Stale     string
-	Algorithm string
-	Qop       string
-	Header    string
-}
-
-// Route that should never be a constructor default.
-//const dummyRoute = "0x8b6c42"
-
 // Attack attacks the given targets and returns the accessed streams.
 func (s *Scanner) Attack(targets []Stream) ([]Stream, error) {
+	return s.AttackContext(context.Background(), targets)
+}
+
+// AttackContext attacks the given targets and returns the accessed streams.
+// If the context is canceled, the attack stops as soon as possible and the
+// streams are returned as they were at that point, along with the context's error.
+func (s *Scanner) AttackContext(ctx context.Context, targets []Stream) ([]Stream, error) {
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("no stream found")
 	}
 	//s.client = &gortsplib.Client{}
-	// Most cameras will be accessed successfully with these two attacks.
+	defer s.checkpoint.autosave(ctx)()
+
+	fmt.Printf("Detecting the route behavior of %d streams\n", len(targets))
+	streams := s.runPhase(ctx, targets, phaseRouteBehavior, s.DetectRouteBehaviorsContext)
+	if ctx.Err() != nil {
+		return streams, ctx.Err()
+	}
+
 	fmt.Printf("Attacking routes of %d streams", len(targets))
-	streams := s.AttackRoute(targets)
+	streams = s.runPhase(ctx, streams, phaseRoutes, s.AttackRouteContext)
+	if ctx.Err() != nil {
+		return streams, ctx.Err()
+	}
 
 	fmt.Printf("Attempting to detect authentication methods of %d streams", len(targets))
-	streams = s.DetectAuthMethods(streams)
+	streams = s.runPhase(ctx, streams, phaseAuthMethods, s.DetectAuthMethodsContext)
+	if ctx.Err() != nil {
+		return streams, ctx.Err()
+	}
 
 	fmt.Printf("Attacking credentials of %d streams", len(targets))
-	streams = s.AttackCredentials(streams)
-
-	fmt.Println("Validating that streams are accessible")
-	streams = s.ValidateStreams(streams)
+	streams = s.runPhase(ctx, streams, phaseCredentials, s.AttackCredentialsContext)
+	if ctx.Err() != nil {
+		return streams, ctx.Err()
+	}
 
-	fmt.Println("Streams after first round of attack")
-	s.PrintStreams(streams)
-	// But some cameras run GST RTSP Server which prioritizes 401 over 404 contrary to most cameras.
-	// For these cameras, running another route attack will solve the problem.
+	// Some cameras run GST RTSP Server which prioritizes 401 over 404 contrary to most cameras.
+	// Their routes can only be attacked once their credentials are known.
+	var authFirst []Stream
 	for _, stream := range streams {
-		if !stream.RouteFound || !stream.CredentialsFound || !stream.Available {
-			fmt.Println("Second round of attacks")
-			streams = s.AttackRoute(streams)
+		if stream.RouteBehavior == routeAuthFirst && stream.CredentialsFound && !stream.RouteFound {
+			authFirst = append(authFirst, stream)
+		}
+	}
+	if len(authFirst) > 0 {
+		fmt.Printf("Attacking routes of %d streams which require authentication first\n", len(authFirst))
+		for _, stream := range s.runPhase(ctx, authFirst, phaseAuthFirstRoutes, s.AttackRouteContext) {
+			streams = replace(streams, stream)
+		}
+		if ctx.Err() != nil {
+			return streams, ctx.Err()
+		}
+	}
 
-			fmt.Println("Validating that streams are accessible")
-			streams = s.ValidateStreams(streams)
+	fmt.Println("Validating that streams are accessible")
+	streams = s.runPhase(ctx, streams, phaseValidation, s.ValidateStreamsContext)
+	if ctx.Err() != nil {
+		return streams, ctx.Err()
+	}
 
-			break
-		}
+	if s.recordingDir != "" {
+		fmt.Printf("Recording accessible streams into %q\n", s.recordingDir)
+		streams = s.runPhase(ctx, streams, phaseRecording, s.RecordStreamsContext)
 	}
 
-	return streams, nil
+	return streams, ctx.Err()
 }
 
-// ValidateStreams tries to setup the stream to validate whether or not it is available.
-func (s *Scanner) ValidateStreams(targets []Stream) []Stream {
-	for i := range targets {
-		targets[i].Available = s.validateStream(targets[i])
-		time.Sleep(s.attackInterval)
+// runPhase runs an attack phase on the streams which did not complete it
+// yet, and saves its results in the checkpoint. The streams only complete
+// the phase if it was not interrupted.
+func (s *Scanner) runPhase(ctx context.Context, streams []Stream, phase string, run func(context.Context, []Stream) []Stream) []Stream {
+	pending := s.checkpoint.pending(streams, phase)
+	if len(pending) == 0 {
+		return streams
 	}
 
-	return targets
+	for _, stream := range run(ctx, pending) {
+		streams = replace(streams, stream)
+	}
+
+	s.checkpoint.updateStreams(streams...)
+	if ctx.Err() == nil {
+		s.checkpoint.setPhaseDone(pending, phase)
+	}
+	return streams
 }
 
 // AttackCredentials attempts to guess the provided targets' credentials using the given
 // dictionary or the default dictionary if none was provided by the user.
 func (s *Scanner) AttackCredentials(targets []Stream) []Stream {
+	return s.AttackCredentialsContext(context.Background(), targets)
+}
+
+// AttackCredentialsContext is like AttackCredentials, but stops attacking
+// when the context is canceled.
+func (s *Scanner) AttackCredentialsContext(ctx context.Context, targets []Stream) []Stream {
 	resChan := make(chan Stream)
 	defer close(resChan)
 
 	for i := range targets {
-		go s.attackCameraCredentials(targets[i], resChan)
+		go s.attackCameraCredentials(ctx, targets[i], resChan)
 	}
 
 	for range targets {
-		attackResult := <-resChan
-		if attackResult.CredentialsFound {
-			targets = replace(targets, attackResult)
-		}
+		// The results of each route are kept even if no credentials were found.
+		targets = replace(targets, <-resChan)
 	}
 
 	return targets
@@ -108,10 +132,16 @@ func (s *Scanner) AttackCredentials(targets []Stream) []Stream {
 // AttackRoute attempts to guess the provided targets' streaming routes using the given
 // dictionary or the default dictionary if none was provided by the user.
 func (s *Scanner) AttackRoute(targets []Stream) []Stream {
+	return s.AttackRouteContext(context.Background(), targets)
+}
+
+// AttackRouteContext is like AttackRoute, but stops attacking when the
+// context is canceled.
+func (s *Scanner) AttackRouteContext(ctx context.Context, targets []Stream) []Stream {
 	resChan := make(chan Stream)
 	defer close(resChan)
 	for i := range targets {
-		go s.attackCameraRoute(targets[i], resChan)
+		go s.attackCameraRoute(ctx, targets[i], resChan)
 	}
 
 	for range targets {
@@ -126,131 +156,325 @@ func (s *Scanner) AttackRoute(targets []Stream) []Stream {
 // DetectAuthMethods attempts to guess the provided targets' authentication types, between
 // digest, basic auth or none at all.
 func (s *Scanner) DetectAuthMethods(targets []Stream) []Stream {
+	return s.DetectAuthMethodsContext(context.Background(), targets)
+}
+
+// DetectAuthMethodsContext is like DetectAuthMethods, but stops detecting
+// authentication types when the context is canceled.
+func (s *Scanner) DetectAuthMethodsContext(ctx context.Context, targets []Stream) []Stream {
 	for i := range targets {
-		targets[i].AuthenticationType = s.detectAuthMethod(targets[i])
-		time.Sleep(s.attackInterval)
+		targets[i].syncRouteResults()
+		for j := range targets[i].RouteResults {
+			result := &targets[i].RouteResults[j]
+
+			challenges, err := s.detectAuthMethod(ctx, targets[i].forRoute(*result))
+			if err != nil {
+				if s.debug {
+					fmt.Printf("Unable to detect the authentication method of %s: %v\n", GetCameraRTSPURL(targets[i].forRoute(*result)), err)
+				}
+			} else {
+				result.AuthMethods = challenges
+				result.AuthenticationType = preferredAuthType(challenges)
+			}
 
-		var authMethod string
-		switch targets[i].AuthenticationType {
-		case 0:
-			authMethod = "no"
-		case 1:
-			authMethod = "basic"
-		case 2:
-			authMethod = "digest"
-		default:
-			authMethod = "unknown:" + string(targets[i].AuthenticationType)
+			if s.scheduler.wait(ctx, targets[i].Address) != nil {
+				break
+			}
+		}
+
+		primary := targets[i].RouteResults[0]
+		if primary.AuthenticationType != "" {
+			targets[i].AuthMethods = primary.AuthMethods
+			targets[i].AuthenticationType = primary.AuthenticationType
+
+			// The realm of the authentication challenge often names the vendor
+			// when the banner does not.
+			if targets[i].Device == "" {
+				targets[i].Device = fingerprintRealms(primary.AuthMethods)
+			}
+		}
+
+		authMethod := targets[i].AuthenticationType
+		if authMethod == "" {
+			authMethod = "unknown"
 		}
 
 		fmt.Printf("Stream %s uses %s authentication method\n", GetCameraRTSPURL(targets[i]), authMethod)
+
+		if ctx.Err() != nil {
+			break
+		}
 	}
 
 	return targets
 }
 
-func (s *Scanner) attackCameraCredentials(target Stream, resChan chan<- Stream) {
-	for _, username := range s.credentials.Usernames {
-		for _, password := range s.credentials.Passwords {
-			ok, media := s.credAttack(target, username, password)
-			if ok {
-				target.CredentialsFound = true
-				target.Username = username
-				target.Password = password
-				target.Media = media
-				resChan <- target
-				return
+// credentialAttempt is a username and password to try.
+type credentialAttempt struct {
+	username string
+	password string
+}
+
+// attackCameraCredentials attacks the credentials of each route of the
+// stream. The credentials found for the previous routes are tried first,
+// since the routes of a device usually share them. The attack is given up
+// if the server locks the attempts out.
+func (s *Scanner) attackCameraCredentials(ctx context.Context, target Stream, resChan chan<- Stream) {
+	target.syncRouteResults()
+	lockout := newLockoutDetector(s, target)
+
+	var known []credentialAttempt
+	found := -1
+	for i := range target.RouteResults {
+		result := &target.RouteResults[i]
+
+		// The credentials of the route may have been confirmed
+		// before the scan was resumed.
+		if result.CredentialsFound {
+			creds := credentialAttempt{username: result.Username, password: result.Password}
+			if !slices.Contains(known, creds) {
+				known = append(known, creds)
 			}
-			time.Sleep(s.attackInterval)
+			if found < 0 {
+				found = i
+			}
+			continue
 		}
-	}
 
-	target.CredentialsFound = false
-	resChan <- target
-}
+		// Routes which do not ask for credentials accept any of them, so
+		// the dictionary is not tried and no credentials are reported. Servers
+		// which answer that a route is not found do not tell whether it
+		// needs credentials, so missing routes are still attacked.
+		routeTarget := target.forRoute(*result)
+		if routeTarget.AuthenticationType == authNone && target.RouteFound {
+			result.CredentialsFound = true
+			result.Username = ""
+			result.Password = ""
+			if found < 0 {
+				found = i
+			}
+			continue
+		}
 
-func (s *Scanner) attackCameraRoute(target Stream, resChan chan<- Stream) {
-	// If the stream responds positively to the dummy route, it means
-	// it doesn't require (or respect the RFC) a route and the attack
-	// can be skipped.
-	// ok := s.routeAttack(target, dummyRoute)
-	// if ok {
-	// 	target.RouteFound = true
-	// 	target.Routes = append(target.Routes, "/")
-	// 	resChan <- target
-	// 	if s.debug {
-	// 		fmt.Printf("Positive to dummy route: %s", target.Address)
-	// 	}
-	// 	return
-	// }
-
-	// Otherwise, bruteforce the routes.
-	for _, route := range s.routes {
-		ok := s.routeAttack(target, route)
+		creds, media, ok := s.attackRouteCredentials(ctx, routeTarget, known, lockout)
 		if ok {
-			target.RouteFound = true
-			target.Routes = append(target.Routes, route)
-			// if s.debug {
-			// 	fmt.Printf("Negative to dummy route: %s", target.Address)
-			// }
+			result.CredentialsFound = true
+			result.Username = creds.username
+			result.Password = creds.password
+			result.Media = media
+
+			if !slices.Contains(known, creds) {
+				known = append(known, creds)
+			}
+			if found < 0 {
+				found = i
+			}
+			s.checkpoint.updateStreams(target)
+			s.events.emit(eventCredentialsFound, target, event{
+				Device:   target.Device,
+				Route:    eventRoute(result.Route),
+				Username: creds.username,
+				Password: creds.password,
+			})
+		}
+
+		if ctx.Err() != nil || lockout.locked() {
+			break
 		}
-		time.Sleep(s.attackInterval)
 	}
-	if len(target.Routes) > 10 {
-		target.Routes = []string{""}
+
+	if found >= 0 {
+		target.setPrimaryRoute(found)
 	}
+	lockout.report(&target)
 	resChan <- target
 }
 
-func parseAuthHeader(wwwAuthenticate string) *AuthInfo {
-	info := &AuthInfo{Header: wwwAuthenticate}
-
-	if strings.HasPrefix(strings.ToLower(wwwAuthenticate), "digest") {
-		info.Type = "Digest"
-		// Extract digest parameters
-		parts := strings.SplitN(wwwAuthenticate, " ", 2)
-		if len(parts) > 1 {
-			params := parts[1]
-			// Simple parsing of key=value pairs
-			pairs := strings.Split(params, ",")
-			for _, pair := range pairs {
-				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
-				if len(kv) == 2 {
-					key := strings.TrimSpace(kv[0])
-					value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
-
-					switch key {
-					case "realm":
-						info.Realm = value
-					case "nonce":
-						info.Nonce = value
-					case "opaque":
-						info.Opaque = value
-					case "stale":
-						info.Stale = value
-					case "algorithm":
-						info.Algorithm = value
-					case "qop":
-						info.Qop = value
-					}
-				}
+// attackRouteCredentials attacks the credentials of the only route of the
+// stream, trying the known credentials before the ones of the dictionary.
+// Credentials which the server refused to check are tried again once the
+// lockout detector paused the attack. The credentials of the dictionary
+// that were tried before the scan was resumed are skipped.
+//
+// Although attempts run concurrently, the credentials that are reported are
+// the first ones that the stream accepts in the order they are tried, so
+// that the results do not depend on which answer arrives first.
+func (s *Scanner) attackRouteCredentials(ctx context.Context, target Stream, known []credentialAttempt, lockout *lockoutDetector) (credentialAttempt, description.Session, bool) {
+	// Workers stop if the server locks the attempts out.
+	attackCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// No more attempts are made once credentials are found, but the
+	// attempts that come before them are still waited for.
+	produceCtx, stopProducing := context.WithCancel(attackCtx)
+	defer stopProducing()
+
+	// Attempts are numbered in the order they are tried by order. Attempts
+	// of the dictionary have their position in it as index, starting at 1,
+	// and known credentials have none.
+	type indexedAttempt struct {
+		creds credentialAttempt
+		order int64
+		index int
+	}
+
+	start := s.checkpoint.position(target)
+	progress := newDictionaryProgress(start)
+	attempts := make(chan indexedAttempt)
+	go func() {
+		defer close(attempts)
+
+		var order int64
+		send := func(attempt indexedAttempt) bool {
+			order++
+			attempt.order = order
+			select {
+			case attempts <- attempt:
+				return true
+			case <-produceCtx.Done():
+				return false
 			}
 		}
-	} else if strings.HasPrefix(strings.ToLower(wwwAuthenticate), "basic") {
-		info.Type = "Basic"
-		parts := strings.SplitN(wwwAuthenticate, " ", 2)
-		if len(parts) > 1 {
-			info.Realm = strings.Trim(parts[1], `"`)
+
+		for _, creds := range known {
+			if !send(indexedAttempt{creds: creds}) {
+				return
+			}
 		}
+
+		index := 0
+		for username, password := range s.credentials.forVendor(target.Device).attempts() {
+			index++
+			creds := credentialAttempt{username: username, password: password}
+			if index <= start {
+				continue
+			}
+			if slices.Contains(known, creds) {
+				progress.done(index)
+				continue
+			}
+			if !send(indexedAttempt{creds: creds, index: index}) {
+				return
+			}
+		}
+	}()
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var found bool
+	var result credentialAttempt
+	var resultMedia description.Session
+	// best is the order of the first attempt that succeeded so far.
+	var best atomic.Int64
+	best.Store(math.MaxInt64)
+	for range s.hostConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := s.scheduler.acquire(attackCtx, target.Address)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			// Once the authentication method of the stream is known, the credentials
+			// are tried over a single connection, without negotiating the
+			// authentication again on each attempt.
+			attempt := func(username, password string) attemptResult {
+				return s.credAttack(attackCtx, target, username, password)
+			}
+			if challenge, ok := supportedChallenge(target.AuthMethods); ok {
+				attacker := &credentialAttacker{scanner: s, stream: target, signer: challengeSigner{challenge: challenge}}
+				defer attacker.close()
+				attempt = func(username, password string) attemptResult {
+					return attacker.attempt(attackCtx, username, password)
+				}
+			}
+
+			for indexed := range attempts {
+				creds := indexed.creds
+				for {
+					// Attempts are received in order, so once credentials
+					// were found, the attempts left can only come after them.
+					if indexed.order > best.Load() {
+						break
+					}
+
+					if s.scheduler.wait(attackCtx, target.Address) != nil {
+						return
+					}
+
+					attemptRes := attempt(creds.username, creds.password)
+					retry, stop := lockout.observe(attemptRes)
+					if stop {
+						cancel()
+						return
+					}
+
+					if attemptRes.ok {
+						mutex.Lock()
+						if indexed.order < best.Load() {
+							found = true
+							result = creds
+							resultMedia = attemptRes.media
+							best.Store(indexed.order)
+						}
+						mutex.Unlock()
+						stopProducing()
+						return
+					}
+
+					if !retry {
+						break
+					}
+				}
+
+				if indexed.index > 0 {
+					s.checkpoint.setPosition(target, progress.done(indexed.index))
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
-	return info
+	return result, resultMedia, found
 }
 
-func detectAuthentication(resp *base.Response) *AuthInfo {
-	if authHeaders, ok := resp.Header["WWW-Authenticate"]; ok && len(authHeaders) > 0 {
-		return parseAuthHeader(authHeaders[0])
+func (s *Scanner) attackCameraRoute(ctx context.Context, target Stream, resChan chan<- Stream) {
+	switch {
+	case target.RouteFound:
+	case target.RouteBehavior == routeAcceptsAny:
+		// The stream doesn't require (or respect the RFC) a route,
+		// so the attack can be skipped.
+		target.RouteFound = true
+		target.Routes = []string{""}
+	case target.RouteBehavior == routeAuthFirst && !target.CredentialsFound:
+		// Every route gets the same answer until the credentials are known.
+	default:
+		// Otherwise, bruteforce the routes, starting with the known routes
+		// of the device's vendor.
+		routes := s.routeAttack(ctx, target, s.routes.forVendor(target.Device), s.routeDiscovery == routeDiscoveryFirst)
+
+		// Then look for the routes of the channels that the dictionary
+		// does not have routes for.
+		if s.routeDiscovery == routeDiscoveryPerChannel {
+			routes = firstRoutePerChannel(routes)
+			if extra := channelRoutes(routes); len(extra) > 0 {
+				others := s.routeAttack(ctx, target, extra, false)
+				routes = append(routes, firstRoutePerChannel(others)...)
+			}
+		}
+
+		if len(routes) > 0 {
+			target.RouteFound = true
+			target.Routes = append(target.Routes, routes...)
+		}
+		for _, route := range routes {
+			s.events.emit(eventRouteFound, target, event{Device: target.Device, Route: eventRoute(route)})
+		}
 	}
-	return nil
+	resChan <- target
 }
 
 // func detectTrack(sessionData description.Session) string {
@@ -329,12 +553,14 @@ func detectAuthentication(resp *base.Response) *AuthInfo {
 // 	return mes
 // }
 
-func (s *Scanner) detectAuthMethod(stream Stream) headers.AuthMethod {
-	rawURL := fmt.Sprintf(("rtsp://%s:%d/%s"), stream.Address, stream.Port, stream.Route())
+// detectAuthMethod returns the authentication challenges that the stream
+// answers a DESCRIBE request without credentials with. There is none if the
+// stream does not require authentication.
+func (s *Scanner) detectAuthMethod(ctx context.Context, stream Stream) ([]AuthInfo, error) {
+	rawURL := fmt.Sprintf("rtsp://%s/%s", streamHost(stream), stream.Route())
 	attackURL, err := base.ParseURL(rawURL)
 	if err != nil {
-		fmt.Errorf("Url parsing %q failed: %v", rawURL, err)
-		return -1
+		return nil, fmt.Errorf("parsing url %q: %w", rawURL, err)
 	}
 
 	client := gortsplib.Client{
@@ -342,68 +568,324 @@ func (s *Scanner) detectAuthMethod(stream Stream) headers.AuthMethod {
 		Host:   attackURL.Host,
 	}
 
-	err = client.Start()
+	closeClient, err := startClient(ctx, &client)
 	if err != nil {
-		fmt.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return -1
+		return nil, err
 	}
+	defer closeClient()
 
 	_, rc, err := client.Describe(attackURL)
-	if err != nil {
-		fmt.Errorf("detectAuthMethod Getinfo failed for %s: %v", attackURL, err)
-		return -1
+	if rc == nil {
+		return nil, err
 	}
 
-	authinfo := detectAuthentication(rc)
-	if authinfo.Type == "digest" {
-		return 2
-	} else if authinfo.Type == "basic" {
-		return 1
-	}
-	return 0
+	return parseAuthChallenges(rc.Header["WWW-Authenticate"]), nil
 }
 
-func (s *Scanner) routeAttack(stream Stream, route string) bool {
-	rawURL := fmt.Sprintf(("rtsp://%s:%d/%s"), stream.Address, stream.Port, route)
-	attackURL, err := base.ParseURL(rawURL)
-	if err != nil {
-		fmt.Errorf("Url parsing %q failed: %v", rawURL, err)
-		return false
+const (
+	// routePipelineDepth is the maximum amount of DESCRIBE requests
+	// sent through a connection before their responses are received.
+	routePipelineDepth = 16
+
+	// routeRedialAttempts is how many more times a route worker opens its
+	// connection again when it fails to, and routeRedialBackoff is the first
+	// pause before it does, which doubles after each failure.
+	routeRedialAttempts = 3
+	routeRedialBackoff  = 500 * time.Millisecond
+)
+
+// routeAttack sends a DESCRIBE request for each route and returns the routes
+// that exist, or only the first one of them if first is set. Each worker
+// attacking the stream sends its requests through a single connection,
+// in a pipeline.
+func (s *Scanner) routeAttack(ctx context.Context, stream Stream, routes Routes, first bool) []string {
+	var urls []*base.URL
+	var urlRoutes []string
+	for _, route := range routes {
+		rawURL := fmt.Sprintf("rtsp://%s/%s", streamHost(stream), route)
+		attackURL, err := base.ParseURL(rawURL)
+		if err != nil {
+			if s.debug {
+				fmt.Printf("Url parsing %q failed: %v\n", rawURL, err)
+			}
+			continue
+		}
+		urls = append(urls, attackURL)
+		urlRoutes = append(urlRoutes, route)
+	}
+	if len(urls) == 0 {
+		return nil
 	}
 
-	client := &gortsplib.Client{
-		Scheme: attackURL.Scheme,
-		Host:   attackURL.Host,
+	probe := s.newRouteProbe(stream)
+
+	// Each route is tried by a single worker, which marks it as found if
+	// it exists, so that the routes are returned in the dictionary order.
+	var next atomic.Int64
+	exists := make([]bool, len(urls))
+
+	// Once a route is found, only the routes before it are still needed
+	// when looking for the first route.
+	var firstFound atomic.Int64
+	firstFound.Store(int64(len(urls)))
+	if first {
+		probe.found = func(i int) {
+			for {
+				current := firstFound.Load()
+				if int64(i) >= current || firstFound.CompareAndSwap(current, int64(i)) {
+					return
+				}
+			}
+		}
+		probe.wanted = func(i int) bool {
+			return int64(i) < firstFound.Load()
+		}
 	}
-	client.OptionsSent = true
-	err = client.Start()
-	defer client.Close()
-	if err != nil {
-		fmt.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return false
+
+	var wg sync.WaitGroup
+	for range s.hostConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := s.scheduler.acquire(ctx, stream.Address)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			s.routeWorker(ctx, stream, probe, urls, &next, exists)
+		}()
 	}
-	_, rc, err := client.Describe(attackURL)
-	if err != nil {
-		if rc != nil && (rc.StatusCode == base.StatusOK || rc.StatusCode == base.StatusUnauthorized || rc.StatusCode == base.StatusForbidden) {
+	wg.Wait()
+
+	var found []string
+	for i, ok := range exists {
+		if ok {
+			found = append(found, urlRoutes[i])
+			if first {
+				break
+			}
+		}
+	}
+	return found
+}
+
+// routeWorker sends DESCRIBE requests for the URLs that are not taken yet by
+// other workers through a single connection, and marks those which exist.
+// Requests are pipelined, and when the server closes the connection, it is
+// opened again and the requests that were not answered are sent again, one
+// at a time, since the server may not support pipelining.
+func (s *Scanner) routeWorker(ctx context.Context, stream Stream, probe routeProbe, urls []*base.URL, next *atomic.Int64, exists []bool) {
+	var conn *rtspConn
+	defer func() {
+		if conn != nil {
+			conn.close()
+		}
+	}()
+
+	// Servers may tie their nonces to a connection, so each new connection
+	// asks for a challenge before sending credentials through it.
+	signer := probe.signer()
+	dial := func() (*rtspConn, error) {
+		conn, err := dialRTSP(ctx, stream, s.timeout)
+		if err != nil || signer == nil {
+			return conn, err
+		}
+		err = signer.signer.connect(conn, urls[0])
+		if err != nil {
+			conn.close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	depth := routePipelineDepth
+	// pending are the indexes of the URLs whose response is expected, and
+	// retry the ones which need to be sent again through a new connection.
+	var pending, retry []int
+	// progressed is whether a response was received through the connection,
+	// which prevents reconnecting forever to a server that answers nothing.
+	progressed := true
+	for {
+		if conn == nil {
+			if !progressed {
+				return
+			}
+
+			var err error
+			conn, err = dial()
+			// The URLs that were not answered would not be tried by any other
+			// worker, so the connection is opened again a few times before
+			// giving up on them.
+			for attempt := 0; err != nil && len(retry) > 0 && attempt < routeRedialAttempts; attempt++ {
+				if sleep(ctx, routeRedialBackoff<<attempt) != nil {
+					return
+				}
+				conn, err = dial()
+			}
+			if err != nil {
+				if s.debug {
+					fmt.Printf("Perform failed for %s: %v\n", streamHost(stream), err)
+				}
+				return
+			}
+			progressed = false
+		}
+
+		var err error
+		for len(pending) < depth && err == nil {
+			var i int
+			if len(retry) > 0 {
+				i, retry = retry[0], retry[1:]
+			} else if i = int(next.Add(1) - 1); i >= len(urls) {
+				break
+			}
+			if !probe.wanted(i) {
+				continue
+			}
+
+			if s.scheduler.wait(ctx, stream.Address) != nil {
+				return
+			}
+
+			var header base.Header
+			if signer != nil {
+				header, err = signer.header(urls[i])
+			}
+			if err == nil {
+				err = conn.send(base.Describe, urls[i], header)
+			}
+			if err != nil {
+				retry = append([]int{i}, retry...)
+				break
+			}
+			pending = append(pending, i)
+		}
+
+		if err == nil && len(pending) == 0 {
+			return
+		}
+
+		var res *base.Response
+		if err == nil {
+			res, err = conn.receive()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			if s.debug {
-				fmt.Println("Successfull DESCRIBE", attackURL, "RTSP/1.0 >", rc, "Response URL")
+				fmt.Printf("routeAttack Getinfo failed for %s: %v\n", streamHost(stream), err)
 			}
-			return true
-		} else {
-			fmt.Errorf("routeAttack Getinfo failed: %v", err)
-			return false
+
+			conn.close()
+			conn = nil
+			retry = append(pending, retry...)
+			pending = nil
+			depth = 1
+			continue
 		}
-	} else {
-		return true
+		progressed = true
+
+		i := pending[0]
+		pending = pending[1:]
+
+		if signer != nil && signer.resend(i, res) {
+			retry = append(retry, i)
+			continue
+		}
+
+		if probe.exists(res.StatusCode) {
+			if s.debug {
+				fmt.Println("Successfull DESCRIBE", urls[i], "RTSP/1.0 >", res.StatusCode)
+			}
+			exists[i] = true
+			probe.found(i)
+		}
+	}
+}
+
+// routeProbe builds the requests of a route attack, and tells whether
+// routes exist from the responses to these requests.
+type routeProbe struct {
+	// signer returns the signer of the requests sent through a new
+	// connection, or nil if they are sent without credentials.
+	signer func() *routeSigner
+	exists func(status base.StatusCode) bool
+	// wanted tells whether the route of the given index still needs to be
+	// tried, and found is called with the index of each route found.
+	wanted func(i int) bool
+	found  func(i int)
+}
+
+// newRouteProbe returns the route probe of the stream. Routes usually exist
+// if the server does not answer that they are not found, but servers which
+// authenticate before checking the route answer with the same error to
+// every route, so they are sent the credentials of the stream and only the
+// routes that they accept exist.
+func (s *Scanner) newRouteProbe(stream Stream) routeProbe {
+	probe := routeProbe{
+		signer: func() *routeSigner { return nil },
+		exists: func(status base.StatusCode) bool {
+			return status == base.StatusOK || status == base.StatusUnauthorized || status == base.StatusForbidden
+		},
+		wanted: func(int) bool { return true },
+		found:  func(int) {},
+	}
+	if stream.RouteBehavior != routeAuthFirst || !stream.CredentialsFound {
+		return probe
+	}
+
+	probe.exists = func(status base.StatusCode) bool {
+		return status == base.StatusOK
+	}
+
+	if challenge, ok := supportedChallenge(stream.AuthMethods); ok {
+		probe.signer = func() *routeSigner {
+			return &routeSigner{stream: stream, signer: challengeSigner{challenge: challenge}}
+		}
+	}
+
+	return probe
+}
+
+// routeSigner signs the requests of a route worker with the credentials of
+// the stream. Like the credentials, they are sent again once when the
+// server tells that the nonce with which they were signed expired.
+type routeSigner struct {
+	stream Stream
+	signer challengeSigner
+	// resent are the indexes of the URLs that were sent again.
+	resent map[int]bool
+}
+
+// header returns the headers of the request for the URL.
+func (r *routeSigner) header(u *base.URL) (base.Header, error) {
+	return r.signer.header(u, r.stream.Username, r.stream.Password)
+}
+
+// resend returns whether the request for the URL of the given index needs to
+// be sent again, since the server answered it with a new, stale nonce.
+func (r *routeSigner) resend(i int, res *base.Response) bool {
+	if res.StatusCode != base.StatusUnauthorized || !r.signer.update(res) || r.resent[i] {
+		return false
 	}
+	if r.resent == nil {
+		r.resent = make(map[int]bool)
+	}
+	r.resent[i] = true
+	return true
 }
 
-func (s *Scanner) credAttack(stream Stream, username string, password string) (bool, description.Session) {
-	rawURL := fmt.Sprintf(("rtsp://%s:%s@%s:%d/%s"), username, password, stream.Address, stream.Port, stream.Route())
+func (s *Scanner) credAttack(ctx context.Context, stream Stream, username string, password string) attemptResult {
+	rawURL := fmt.Sprintf("rtsp://%s:%s@%s/%s", username, password, streamHost(stream), stream.Route())
 	attackURL, err := base.ParseURL(rawURL)
 	if err != nil {
-		fmt.Errorf("Url parsing %q failed: %v", rawURL, err)
-		return false, description.Session{}
+		if s.debug {
+			fmt.Printf("Url parsing %q failed: %v\n", rawURL, err)
+		}
+		return attemptResult{err: err}
 	}
 
 	client := &gortsplib.Client{
@@ -412,149 +894,192 @@ func (s *Scanner) credAttack(stream Stream, username string, password string) (b
 	}
 	client.OptionsSent = true
 
-	err = client.Start()
-	defer client.Close()
+	result := attemptResult{start: time.Now()}
+	closeClient, err := startClient(ctx, client)
 	if err != nil {
-		fmt.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return false, description.Session{}
+		if s.debug {
+			fmt.Printf("Perform failed for %q (auth %s): %v\n", attackURL, stream.AuthenticationType, err)
+		}
+		result.err = err
+		result.latency = time.Since(result.start)
+		return result
 	}
+	defer closeClient()
 
 	desc, rc, err := client.Describe(attackURL)
+	result.res, result.err = rc, err
+	result.latency = time.Since(result.start)
 	if err != nil {
-		fmt.Errorf("credAttack Getinfo failed for %s: %v", err, attackURL)
-		return false, description.Session{}
+		if s.debug {
+			fmt.Printf("credAttack Getinfo failed for %s: %v\n", attackURL, err)
+		}
+		return result
 	}
 
 	// If it's a 404, it means that the route is incorrect but the credentials might be okay.
 	// If it's a 200, the stream is accessed successfully.
 	if rc.StatusCode == base.StatusOK || rc.StatusCode == base.StatusNotFound {
-		return true, *desc
+		result.ok = true
+		if desc != nil {
+			result.media = *desc
+		}
 	}
-	return false, description.Session{}
+	return result
 }
 
-// func saveToFile(img image.Image) error {
-// 	// create file
-// 	fname := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10) + ".jpg"
-// 	f, err := os.Create(fname)
-// 	if err != nil {
-// 		panic(err)
-// 	}
-// 	defer f.Close()
-
-// 	log.Println("saving", fname)
-
-// 	// convert to jpeg
-// 	return jpeg.Encode(f, img, &jpeg.Options{
-// 		Quality: 60,
-// 	})
-// }
+// credentialAttacker tries credentials against a stream through a single
+// connection, answering the authentication challenge of the stream itself.
+// Since some servers tie their nonces to a connection, the challenge is
+// asked for again on each new connection, and the latest nonce sent by the
+// server is always used.
+type credentialAttacker struct {
+	scanner *Scanner
+	stream  Stream
+	signer  challengeSigner
+	conn    *rtspConn
+}
 
-func (s *Scanner) validateStream(stream Stream) bool {
-	rawURL := fmt.Sprintf(
-		"rtsp://%s:%s@%s:%d/%s",
-		stream.Username,
-		stream.Password,
-		stream.Address,
-		stream.Port,
-		stream.Route(),
-	)
+// attempt returns whether the credentials are accepted by the stream,
+// along with the description of the stream when its route is correct.
+func (a *credentialAttacker) attempt(ctx context.Context, username, password string) attemptResult {
+	rawURL := fmt.Sprintf("rtsp://%s/%s", streamHost(a.stream), a.stream.Route())
 	attackURL, err := base.ParseURL(rawURL)
 	if err != nil {
-		fmt.Errorf("Url parsing %q failed: %v", rawURL, err)
-		return false
+		if a.scanner.debug {
+			fmt.Printf("Url parsing %q failed: %v\n", rawURL, err)
+		}
+		return attemptResult{err: err}
 	}
 
-	client := &gortsplib.Client{
-		Scheme: attackURL.Scheme,
-		Host:   attackURL.Host,
+	start := time.Now()
+	res, err := a.describe(ctx, attackURL, username, password)
+	if err == nil && res.StatusCode == base.StatusUnauthorized && a.signer.update(res) {
+		res, err = a.describe(ctx, attackURL, username, password)
 	}
-	// connect to the server
-	err = client.Start()
+	result := attemptResult{res: res, err: err, start: start, latency: time.Since(start)}
 	if err != nil {
-		fmt.Println(err)
-		return false
+		if a.scanner.debug {
+			fmt.Printf("credAttack Getinfo failed for %s: %v\n", attackURL, err)
+		}
+		return result
 	}
-	defer client.Close()
 
-	// find available medias
-	desc, _, err := client.Describe(attackURL)
-	if err != nil {
-		fmt.Println(err)
-		return false
+	// If it's a 404, it means that the route is incorrect but the credentials might be okay.
+	// If it's a 200, the stream is accessed successfully.
+	switch res.StatusCode {
+	case base.StatusOK:
+		result.ok = true
+		result.media, err = parseSessionDescription(attackURL, res)
+		if err != nil && a.scanner.debug {
+			fmt.Printf("Unable to parse the description of %s: %v\n", attackURL, err)
+		}
+	case base.StatusNotFound:
+		result.ok = true
 	}
+	return result
+}
 
-	// find the H264 media and format
-	var forma *format.H264
-	medi := desc.FindFormat(&forma)
-	if medi == nil {
-		fmt.Errorf("media not found")
-		return false
+// describe sends a DESCRIBE request with the credentials. If the server
+// closed the connection since the previous attempt, it is opened again.
+func (a *credentialAttacker) describe(ctx context.Context, attackURL *base.URL, username, password string) (*base.Response, error) {
+	if a.conn != nil {
+		res, err := a.describeWith(attackURL, username, password)
+		if err == nil {
+			return res, nil
+		}
+		a.close()
 	}
 
-	// setup RTP -> H264 decoder
-	rtpDec, err := forma.CreateDecoder()
+	err := a.connect(ctx, attackURL)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return nil, err
 	}
+	return a.describeWith(attackURL, username, password)
+}
 
-	// setup H264 -> MPEG-TS muxer
-	mpegtsMuxer := &mpegtsMuxer{
-		fileName: "mystream.ts",
-		sps:      forma.SPS,
-		pps:      forma.PPS,
+// describeWith sends a DESCRIBE request with the credentials through
+// the connection of the attacker.
+func (a *credentialAttacker) describeWith(attackURL *base.URL, username, password string) (*base.Response, error) {
+	header, err := a.signer.header(attackURL, username, password)
+	if err != nil {
+		return nil, err
 	}
-	err = mpegtsMuxer.initialize()
+	return a.conn.describe(attackURL, header)
+}
+
+// connect opens a connection to the stream.
+func (a *credentialAttacker) connect(ctx context.Context, attackURL *base.URL) error {
+	conn, err := dialRTSP(ctx, a.stream, a.scanner.timeout)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	defer mpegtsMuxer.close()
 
-	// setup a single media
-	_, err = client.Setup(desc.BaseURL, medi, 0, 0)
+	err = a.signer.connect(conn, attackURL)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		conn.close()
+		return err
 	}
 
-	// called when a RTP packet arrives
-	client.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
-		// decode timestamp
-		pts, ok := client.PacketPTS(medi, pkt)
-		if !ok {
-			log.Print("waiting for timestamp")
-			return
-		}
+	a.conn = conn
+	return nil
+}
 
-		// extract access unit from RTP packets
-		au, err2 := rtpDec.Decode(pkt)
-		if err2 != nil {
-			if !errors.Is(err2, rtph264.ErrNonStartingPacketAndNoPrevious) && !errors.Is(err2, rtph264.ErrMorePacketsNeeded) {
-				log.Printf("ERR: %v", err2)
-			}
-			return
-		}
+// close closes the connection of the attacker, if it is open.
+func (a *credentialAttacker) close() {
+	if a.conn != nil {
+		a.conn.close()
+		a.conn = nil
+	}
+}
 
-		// encode the access unit into MPEG-TS
-		err2 = mpegtsMuxer.writeH264(au, pts)
-		if err2 != nil {
-			log.Printf("ERR: %v", err2)
-			return
-		}
+// challengeSigner signs the requests sent through a connection, answering
+// the challenge of the server with the latest nonce that it sent.
+type challengeSigner struct {
+	challenge AuthInfo
+	// nc is the amount of requests sent with the nonce of the challenge.
+	nc int
+}
+
+// header returns the headers of a DESCRIBE request for the URL
+// with the credentials.
+func (c *challengeSigner) header(u *base.URL, username, password string) (base.Header, error) {
+	authorization, err := c.challenge.authorization(base.Describe, u.String(), username, password, c.nc)
+	if err != nil {
+		return nil, err
+	}
+	c.nc++
+
+	return base.Header{"Authorization": base.HeaderValue{authorization}}, nil
+}
 
-		fmt.Println("saved TS packet")
-	})
+// connect gets a nonce for a new connection, by sending a DESCRIBE request
+// for the URL without credentials through it, for digest authentication.
+func (c *challengeSigner) connect(conn *rtspConn, u *base.URL) error {
+	if c.challenge.Type != authDigest {
+		return nil
+	}
 
-	// start playing
-	_, err = client.Play(nil)
+	res, err := conn.describe(u, nil)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	client.Wait()
-	// wait until a fatal error
-	//panic(c.Wait())
-	return true
+	c.update(res)
+	return nil
+}
+
+// update answers with the challenge of the response from now on, if it has
+// another nonce or a stale one, and returns whether the request needs to be
+// sent again since the server tells that its nonce expired.
+func (c *challengeSigner) update(res *base.Response) bool {
+	for _, challenge := range parseAuthChallenges(res.Header["WWW-Authenticate"]) {
+		if challenge.Type != c.challenge.Type || challenge.Algorithm != c.challenge.Algorithm {
+			continue
+		}
+		if challenge.Stale || challenge.Nonce != c.challenge.Nonce {
+			c.challenge = challenge
+			c.nc = 0
+		}
+		return challenge.Stale
+	}
+	return false
 }
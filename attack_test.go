@@ -0,0 +1,230 @@
+package cameradar
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// basicAuthorization returns the value of the Authorization header
+// with which the credentials are sent with basic authentication.
+func basicAuthorization(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func TestAttackRouteCredentialsReportsFirstCredentialsOfDictionary(t *testing.T) {
+	// Both admin:admin and root:root are accepted, but the server answers
+	// admin:admin last although it comes first in the dictionary.
+	server := startTestServer(t, func(req testRequest) testResponse {
+		switch req.header.Get("Authorization") {
+		case basicAuthorization("admin", "admin"):
+			time.Sleep(100 * time.Millisecond)
+			return testResponse{status: 200}
+		case basicAuthorization("root", "root"):
+			return testResponse{status: 200}
+		}
+		return testResponse{status: 401, header: map[string]string{"WWW-Authenticate": `Basic realm="cam"`}}
+	})
+
+	stream := server.stream()
+	stream.Routes = []string{"live"}
+	stream.RouteFound = true
+	stream.AuthMethods = []AuthInfo{{Type: authBasic, Realm: "cam"}}
+
+	scanner := newTestScanner(4)
+	scanner.credentials = Credentials{
+		Usernames: []string{"admin", "root"},
+		Passwords: []string{"12345", "admin", "root"},
+	}
+
+	creds, _, found := scanner.attackRouteCredentials(context.Background(), stream, nil, newLockoutDetector(scanner, stream))
+	if !found {
+		t.Fatal("attackRouteCredentials() found no credentials")
+	}
+	want := credentialAttempt{username: "admin", password: "admin"}
+	if creds != want {
+		t.Errorf("attackRouteCredentials() = %+v, want %+v", creds, want)
+	}
+}
+
+func TestAttackRouteCredentialsAnswersDigestChallenges(t *testing.T) {
+	// The server ties its nonces to the connection, answers the third
+	// attempt that it receives with a stale nonce, and closes the connection
+	// after five attempts.
+	type connState struct {
+		nonce    string
+		nc       int
+		attempts int
+	}
+	var mutex sync.Mutex
+	conns := make(map[int]*connState)
+	var stale int
+	server := startTestServer(t, func(req testRequest) testResponse {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		state, ok := conns[req.conn]
+		if !ok {
+			state = &connState{nonce: fmt.Sprintf("%d-0", req.conn)}
+			conns[req.conn] = state
+		}
+		challenge := func(stale bool) testResponse {
+			value := fmt.Sprintf(`Digest realm="cam", qop="auth", nonce="%s"`, state.nonce)
+			if stale {
+				value += ", stale=true"
+			}
+			return testResponse{status: 401, header: map[string]string{"WWW-Authenticate": value}}
+		}
+
+		scheme, rawParams, _ := strings.Cut(req.header.Get("Authorization"), " ")
+		if scheme != "Digest" {
+			return challenge(false)
+		}
+		params := parseAuthParams(rawParams)
+		if params["nonce"] != state.nonce {
+			t.Errorf("connection %d: attempt with nonce %q, want %q", req.conn, params["nonce"], state.nonce)
+			return challenge(false)
+		}
+		state.nc++
+		if want := fmt.Sprintf("%08x", state.nc); params["nc"] != want {
+			t.Errorf("connection %d: attempt with nc %s, want %s", req.conn, params["nc"], want)
+		}
+
+		state.attempts++
+		if state.attempts == 3 && stale == 0 {
+			stale++
+			state.nonce = fmt.Sprintf("%d-1", req.conn)
+			state.nc = 0
+			return challenge(true)
+		}
+
+		digest := func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+		ha1 := digest("admin:cam:12345")
+		ha2 := digest("DESCRIBE:" + params["uri"])
+		want := digest(ha1 + ":" + state.nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if params["response"] == want {
+			return testResponse{status: 200}
+		}
+
+		res := challenge(false)
+		res.close = state.attempts == 5
+		return res
+	})
+
+	stream := server.stream()
+	stream.Routes = []string{"live"}
+	stream.RouteFound = true
+	stream.AuthMethods = []AuthInfo{{Type: authDigest, Realm: "cam", Nonce: "detected", Algorithm: "MD5", Qop: []string{"auth"}}}
+
+	scanner := newTestScanner(1)
+	scanner.credentials = Credentials{
+		Usernames: []string{"admin"},
+		Passwords: []string{"a", "b", "c", "d", "e", "f", "12345"},
+	}
+
+	creds, _, found := scanner.attackRouteCredentials(context.Background(), stream, nil, newLockoutDetector(scanner, stream))
+	if !found {
+		t.Fatal("attackRouteCredentials() found no credentials")
+	}
+	want := credentialAttempt{username: "admin", password: "12345"}
+	if creds != want {
+		t.Errorf("attackRouteCredentials() = %+v, want %+v", creds, want)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if stale != 1 {
+		t.Errorf("server answered %d attempts with a stale nonce, want 1", stale)
+	}
+	if len(conns) != 2 || conns[2].attempts != 3 {
+		t.Errorf("attackRouteCredentials() used %d connections, want 2 with three attempts through the second one", len(conns))
+	}
+}
+
+func TestRouteAttackAnswersNoncesOfEachConnection(t *testing.T) {
+	// The server authenticates before checking the route, ties its nonces to
+	// the connection, and expires them after every eighth request.
+	var mutex sync.Mutex
+	requests := make(map[int]int)
+	server := startTestServer(t, func(req testRequest) testResponse {
+		mutex.Lock()
+		nonce := fmt.Sprintf("%d-%d", req.conn, requests[req.conn]/8)
+		requests[req.conn]++
+		mutex.Unlock()
+
+		challenge := func(stale bool) testResponse {
+			value := fmt.Sprintf(`Digest realm="cam", nonce="%s"`, nonce)
+			if stale {
+				value += ", stale=true"
+			}
+			return testResponse{status: 401, header: map[string]string{"WWW-Authenticate": value}}
+		}
+
+		authorization := req.header.Get("Authorization")
+		if authorization == "" {
+			return challenge(false)
+		}
+		if parseAuthHeader(authorization).Nonce != nonce {
+			return challenge(true)
+		}
+		if slices.Contains([]string{"live", "stream"}, routePath(req.url)) {
+			return testResponse{status: 200}
+		}
+		return testResponse{status: 404}
+	})
+
+	stream := server.stream()
+	stream.RouteBehavior = routeAuthFirst
+	stream.CredentialsFound = true
+	stream.Username = "admin"
+	stream.Password = "12345"
+	stream.AuthMethods = []AuthInfo{{Type: authDigest, Realm: "cam", Nonce: "detected", Algorithm: "MD5"}}
+
+	routes := Routes{"a", "b", "live", "c", "d", "e", "f", "stream", "g"}
+	got := newTestScanner(2).routeAttack(context.Background(), stream, routes, false)
+	want := []string{"live", "stream"}
+	if !slices.Equal(got, want) {
+		t.Errorf("routeAttack() = %q, want %q", got, want)
+	}
+}
+
+func TestRouteAttackWithoutRoutes(t *testing.T) {
+	var mutex sync.Mutex
+	var requests int
+	server := startTestServer(t, func(req testRequest) testResponse {
+		mutex.Lock()
+		requests++
+		mutex.Unlock()
+		return testResponse{status: 401, header: map[string]string{"WWW-Authenticate": `Digest realm="cam", nonce="1"`}}
+	})
+
+	stream := server.stream()
+	stream.RouteBehavior = routeAuthFirst
+	stream.CredentialsFound = true
+	stream.Username = "admin"
+	stream.Password = "12345"
+	stream.AuthMethods = []AuthInfo{{Type: authDigest, Realm: "cam", Nonce: "1", Algorithm: "MD5"}}
+
+	for _, routes := range []Routes{nil, {}} {
+		got := newTestScanner(4).routeAttack(context.Background(), stream, routes, false)
+		if len(got) != 0 {
+			t.Errorf("routeAttack(%q) = %q, want no route", routes, got)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if requests != 0 || server.conns.Load() != 0 {
+		t.Errorf("routeAttack() without routes sent %d requests through %d connections", requests, server.conns.Load())
+	}
+}
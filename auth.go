@@ -0,0 +1,254 @@
+package cameradar
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+)
+
+// Authentication types.
+const (
+	authNone   = "none"
+	authBasic  = "basic"
+	authDigest = "digest"
+)
+
+// AuthInfo is an authentication challenge sent by a server in
+// a WWW-Authenticate header.
+type AuthInfo struct {
+	Type      string   `json:"type"`
+	Realm     string   `json:"realm,omitempty"`
+	Nonce     string   `json:"nonce,omitempty"`
+	Opaque    string   `json:"opaque,omitempty"`
+	Stale     bool     `json:"stale,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	Qop       []string `json:"qop,omitempty"`
+	Header    string   `json:"header"`
+}
+
+// parseAuthHeader parses the value of a WWW-Authenticate header. The scheme
+// and parameter names are case insensitive, and quoted values can contain
+// commas and escaped quotes.
+func parseAuthHeader(wwwAuthenticate string) AuthInfo {
+	info := AuthInfo{Header: wwwAuthenticate}
+
+	scheme, params, _ := strings.Cut(strings.TrimSpace(wwwAuthenticate), " ")
+	switch strings.ToLower(scheme) {
+	case authBasic:
+		info.Type = authBasic
+	case authDigest:
+		info.Type = authDigest
+		// The algorithm defaults to MD5 when the server does not specify it.
+		info.Algorithm = "MD5"
+	default:
+		info.Type = strings.ToLower(scheme)
+	}
+
+	for key, value := range parseAuthParams(params) {
+		switch key {
+		case "realm":
+			info.Realm = value
+		case "nonce":
+			info.Nonce = value
+		case "opaque":
+			info.Opaque = value
+		case "stale":
+			info.Stale = strings.EqualFold(value, "true")
+		case "algorithm":
+			info.Algorithm = strings.ToUpper(value)
+		case "qop":
+			for _, qop := range strings.Split(value, ",") {
+				if qop = strings.TrimSpace(qop); qop != "" {
+					info.Qop = append(info.Qop, strings.ToLower(qop))
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// parseAuthParams parses the comma separated key=value parameters of
+// an authentication challenge. Keys are returned in lower case.
+func parseAuthParams(params string) map[string]string {
+	values := make(map[string]string)
+
+	for {
+		params = strings.TrimLeft(params, " \t,")
+		if params == "" {
+			return values
+		}
+
+		key, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			return values
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, params = readQuotedString(rest[1:])
+		} else {
+			value, params, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+
+		values[key] = value
+	}
+}
+
+// readQuotedString reads a quoted string whose opening quote was already
+// consumed, and returns its unescaped value and what follows it.
+func readQuotedString(s string) (string, string) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	// The closing quote is missing, keep everything.
+	return value.String(), ""
+}
+
+// parseAuthChallenges parses every WWW-Authenticate header of a response.
+func parseAuthChallenges(wwwAuthenticate []string) []AuthInfo {
+	var challenges []AuthInfo
+	for _, header := range wwwAuthenticate {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		challenges = append(challenges, parseAuthHeader(header))
+	}
+	return challenges
+}
+
+// preferredAuthType returns the most secure authentication type among the
+// challenges that cameradar supports, or authNone if there is no challenge.
+func preferredAuthType(challenges []AuthInfo) string {
+	if len(challenges) == 0 {
+		return authNone
+	}
+
+	authType := challenges[0].Type
+	for _, challenge := range challenges {
+		switch challenge.Type {
+		case authDigest:
+			return authDigest
+		case authBasic:
+			authType = authBasic
+		}
+	}
+	return authType
+}
+
+// supportedChallenge returns the challenge that credentials are attacked
+// with, preferring digest over basic authentication, or false if none of
+// the challenges is supported.
+func supportedChallenge(challenges []AuthInfo) (AuthInfo, bool) {
+	for _, challenge := range challenges {
+		if challenge.Type == authDigest && digestHash(challenge.Algorithm) != nil {
+			return challenge, true
+		}
+	}
+	for _, challenge := range challenges {
+		if challenge.Type == authBasic {
+			return challenge, true
+		}
+	}
+	return AuthInfo{}, false
+}
+
+// digestHash returns the hash function of a digest algorithm,
+// or nil if the algorithm is not supported.
+func digestHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	default:
+		return nil
+	}
+}
+
+// authorization returns the value of the Authorization header that answers
+// the challenge for a request, where nc is the amount of requests that were
+// already sent with the nonce of the challenge.
+func (a AuthInfo) authorization(method base.Method, uri, username, password string, nc int) (string, error) {
+	if a.Type == authBasic {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	}
+
+	newHash := digestHash(a.Algorithm)
+	if a.Type != authDigest || newHash == nil {
+		return "", fmt.Errorf("unsupported authentication %s %s", a.Type, a.Algorithm)
+	}
+
+	digest := func(s string) string {
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	ha1 := digest(username + ":" + a.Realm + ":" + password)
+	ha2 := digest(string(method) + ":" + uri)
+
+	header := fmt.Sprintf("Digest username=%s, realm=%s, nonce=%s, uri=%s",
+		quoteAuthParam(username), quoteAuthParam(a.Realm), quoteAuthParam(a.Nonce), quoteAuthParam(uri))
+
+	if slices.Contains(a.Qop, "auth") {
+		cnonceValue, err := newCnonce()
+		if err != nil {
+			return "", err
+		}
+
+		ncValue := fmt.Sprintf("%08x", nc+1)
+		response := digest(ha1 + ":" + a.Nonce + ":" + ncValue + ":" + cnonceValue + ":auth:" + ha2)
+		header += fmt.Sprintf(", qop=auth, nc=%s, cnonce=%s, response=%s", ncValue, quoteAuthParam(cnonceValue), quoteAuthParam(response))
+	} else {
+		header += ", response=" + quoteAuthParam(digest(ha1+":"+a.Nonce+":"+ha2))
+	}
+
+	if a.Opaque != "" {
+		header += ", opaque=" + quoteAuthParam(a.Opaque)
+	}
+	if a.Algorithm != "" {
+		header += ", algorithm=" + a.Algorithm
+	}
+
+	return header, nil
+}
+
+// newCnonce returns the client nonce of a digest authorization.
+var newCnonce = func() (string, error) {
+	cnonce := make([]byte, 8)
+	_, err := rand.Read(cnonce)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(cnonce), nil
+}
+
+var authParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func quoteAuthParam(value string) string {
+	return `"` + authParamEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,235 @@
+package cameradar
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+)
+
+func TestParseAuthHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   AuthInfo
+	}{
+		{
+			name:   "basic",
+			header: `Basic realm="IP Camera"`,
+			want:   AuthInfo{Type: authBasic, Realm: "IP Camera"},
+		},
+		{
+			name:   "lower case basic",
+			header: `basic realm="cam"`,
+			want:   AuthInfo{Type: authBasic, Realm: "cam"},
+		},
+		{
+			name:   "digest defaults to MD5",
+			header: `Digest realm="Hikvision", nonce="abc123"`,
+			want:   AuthInfo{Type: authDigest, Realm: "Hikvision", Nonce: "abc123", Algorithm: "MD5"},
+		},
+		{
+			name:   "upper case scheme and parameters",
+			header: `DIGEST REALM="cam", NONCE="n", Algorithm=sha-256, STALE=TRUE`,
+			want:   AuthInfo{Type: authDigest, Realm: "cam", Nonce: "n", Algorithm: "SHA-256", Stale: true},
+		},
+		{
+			name:   "quoted commas",
+			header: `Digest realm="Login to 00:11:22, building A", nonce="a,b,c", opaque="x"`,
+			want:   AuthInfo{Type: authDigest, Realm: "Login to 00:11:22, building A", Nonce: "a,b,c", Opaque: "x", Algorithm: "MD5"},
+		},
+		{
+			name:   "escaped quotes",
+			header: `Digest realm="the \"main\" camera", nonce="n\\1"`,
+			want:   AuthInfo{Type: authDigest, Realm: `the "main" camera`, Nonce: `n\1`, Algorithm: "MD5"},
+		},
+		{
+			name:   "qop list",
+			header: `Digest realm="r", nonce="n", qop="auth, AUTH-INT", algorithm=SHA-256`,
+			want:   AuthInfo{Type: authDigest, Realm: "r", Nonce: "n", Algorithm: "SHA-256", Qop: []string{"auth", "auth-int"}},
+		},
+		{
+			name:   "unquoted values and extra spaces",
+			header: `  Digest   realm = r ,nonce=n,stale=false  `,
+			want:   AuthInfo{Type: authDigest, Realm: "r", Nonce: "n", Algorithm: "MD5"},
+		},
+		{
+			name:   "missing closing quote",
+			header: `Basic realm="unterminated`,
+			want:   AuthInfo{Type: authBasic, Realm: "unterminated"},
+		},
+		{
+			name:   "unknown scheme",
+			header: `Bearer realm="api"`,
+			want:   AuthInfo{Type: "bearer", Realm: "api"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.want.Header = test.header
+
+			got := parseAuthHeader(test.header)
+			if got.Type != test.want.Type ||
+				got.Realm != test.want.Realm ||
+				got.Nonce != test.want.Nonce ||
+				got.Opaque != test.want.Opaque ||
+				got.Stale != test.want.Stale ||
+				got.Algorithm != test.want.Algorithm ||
+				!slices.Equal(got.Qop, test.want.Qop) ||
+				got.Header != test.want.Header {
+				t.Errorf("parseAuthHeader(%q) is %+v, want %+v", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthChallenges(t *testing.T) {
+	challenges := parseAuthChallenges([]string{
+		`Basic realm="cam"`,
+		"",
+		`Digest realm="cam", nonce="n", algorithm=SHA-256`,
+		`Digest realm="cam", nonce="n"`,
+	})
+	if len(challenges) != 3 {
+		t.Fatalf("parsed %d challenges, want 3", len(challenges))
+	}
+
+	if got := preferredAuthType(challenges); got != authDigest {
+		t.Errorf("preferred authentication type is %q, want %q", got, authDigest)
+	}
+	challenge, ok := supportedChallenge(challenges)
+	if !ok || challenge.Type != authDigest || challenge.Algorithm != "SHA-256" {
+		t.Errorf("supported challenge is %+v, want the SHA-256 digest one", challenge)
+	}
+
+	if got := preferredAuthType(nil); got != authNone {
+		t.Errorf("preferred authentication type without challenges is %q, want %q", got, authNone)
+	}
+
+	basic := parseAuthChallenges([]string{`Digest realm="cam", nonce="n", algorithm=SHA-512-256`, `Basic realm="cam"`})
+	challenge, ok = supportedChallenge(basic)
+	if !ok || challenge.Type != authBasic {
+		t.Errorf("supported challenge is %+v, want the basic one since SHA-512-256 is not supported", challenge)
+	}
+
+	_, ok = supportedChallenge(parseAuthChallenges([]string{`Bearer realm="api"`}))
+	if ok {
+		t.Error("a bearer challenge is supported")
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		username  string
+		password  string
+		uri       string
+		cnonce    string
+		want      map[string]string
+	}{
+		{
+			// RFC 2617, section 3.5.
+			name:      "RFC 2617 MD5 with qop",
+			challenge: `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+			username:  "Mufasa",
+			password:  "Circle Of Life",
+			uri:       "/dir/index.html",
+			cnonce:    "0a4f113b",
+			want: map[string]string{
+				"username": "Mufasa",
+				"realm":    "testrealm@host.com",
+				"nonce":    "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+				"uri":      "/dir/index.html",
+				"qop":      "auth",
+				"nc":       "00000001",
+				"cnonce":   "0a4f113b",
+				"response": "6629fae49393a05397450978507c4ef1",
+				"opaque":   "5ccc069c403ebaf9f0171e9517f40e41",
+			},
+		},
+		{
+			name:      "MD5 without qop",
+			challenge: `Digest realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`,
+			username:  "Mufasa",
+			password:  "Circle Of Life",
+			uri:       "/dir/index.html",
+			want: map[string]string{
+				"response": "670fd8c2df070c60b045671b8b24ff02",
+			},
+		},
+		{
+			// RFC 7616, section 3.9.1.
+			name:      "RFC 7616 MD5",
+			challenge: `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			username:  "Mufasa",
+			password:  "Circle of Life",
+			uri:       "/dir/index.html",
+			cnonce:    "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			want: map[string]string{
+				"response":  "8ca523f5e9506fed4657c9700eebdbec",
+				"algorithm": "MD5",
+			},
+		},
+		{
+			// RFC 7616, section 3.9.1.
+			name:      "RFC 7616 SHA-256",
+			challenge: `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			username:  "Mufasa",
+			password:  "Circle of Life",
+			uri:       "/dir/index.html",
+			cnonce:    "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			want: map[string]string{
+				"response":  "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+				"algorithm": "SHA-256",
+			},
+		},
+	}
+
+	defer func(original func() (string, error)) { newCnonce = original }(newCnonce)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newCnonce = func() (string, error) { return test.cnonce, nil }
+
+			header, err := parseAuthHeader(test.challenge).authorization("GET", test.uri, test.username, test.password, 0)
+			if err != nil {
+				t.Fatalf("authorization failed: %v", err)
+			}
+
+			scheme, params, _ := strings.Cut(header, " ")
+			if scheme != "Digest" {
+				t.Fatalf("authorization %q does not use the digest scheme", header)
+			}
+
+			got := parseAuthParams(params)
+			for key, want := range test.want {
+				if got[key] != want {
+					t.Errorf("%s of %q is %q, want %q", key, header, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthorization(t *testing.T) {
+	// RFC 7617, section 2.
+	header, err := parseAuthHeader(`Basic realm="WallyWorld"`).authorization(base.Describe, "rtsp://cam/", "Aladdin", "open sesame", 0)
+	if err != nil {
+		t.Fatalf("authorization failed: %v", err)
+	}
+
+	want := "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="
+	if header != want {
+		t.Errorf("authorization is %q, want %q", header, want)
+	}
+}
+
+func TestUnsupportedAuthorization(t *testing.T) {
+	_, err := parseAuthHeader(`Digest realm="r", nonce="n", algorithm=SHA-512-256`).authorization(base.Describe, "rtsp://cam/", "u", "p", 0)
+	if err == nil {
+		t.Error("authorization with an unsupported algorithm succeeded")
+	}
+}
@@ -0,0 +1,405 @@
+package cameradar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+)
+
+// checkpointInterval is how often the state of the scan is saved.
+const checkpointInterval = 30 * time.Second
+
+// checkpointVersion is the version of the format of checkpoint files.
+const checkpointVersion = 1
+
+// Attack phases, whose completion is saved for each stream.
+const (
+	phaseRouteBehavior   = "route_behavior"
+	phaseRoutes          = "routes"
+	phaseAuthMethods     = "auth_methods"
+	phaseCredentials     = "credentials"
+	phaseAuthFirstRoutes = "auth_first_routes"
+	phaseValidation      = "validation"
+	phaseRecording       = "recording"
+)
+
+// checkpoint is the state of a scan, which is saved to a file periodically
+// so that an interrupted scan can be resumed without repeating the work it
+// completed. Scans without checkpoint file use a nil checkpoint.
+type checkpoint struct {
+	path string
+
+	mutex sync.Mutex
+	dirty bool
+	state checkpointState
+}
+
+// checkpointState is the content of a checkpoint file.
+type checkpointState struct {
+	Version int      `json:"version"`
+	Targets []string `json:"targets"`
+	Ports   []string `json:"ports"`
+	// Dictionary is the hash of the credentials dictionary, whose
+	// credentials are the ones that Positions count.
+	Dictionary string `json:"dictionary"`
+
+	// ScanDone tells whether every port of every target was scanned.
+	ScanDone bool `json:"scan_done"`
+	// ScannedHosts are the hosts whose every port was scanned.
+	ScannedHosts []string `json:"scanned_hosts,omitempty"`
+
+	// Streams are the streams that were found, along with the results of
+	// their attack. Their media descriptions are not saved, since they are
+	// described again during validation.
+	Streams []Stream `json:"streams,omitempty"`
+	// Phases are the attack phases that each stream completed.
+	Phases map[string][]string `json:"phases,omitempty"`
+	// Positions are the amount of credentials of the dictionary that were
+	// tried in a row from its start against each route of each stream.
+	// The progress of route attacks is not saved, so the ones that were
+	// interrupted start again from the beginning of the route dictionary.
+	Positions map[string]map[string]int `json:"positions,omitempty"`
+
+	scanned map[string]bool
+}
+
+// openCheckpoint returns the checkpoint of a scan of the targets and ports
+// with the credentials dictionary, which is loaded from its file when the
+// scan is resumed.
+func openCheckpoint(path string, resume bool, targets, ports []string, credentials Credentials) (*checkpoint, error) {
+	dictionary, err := dictionaryHash(credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checkpoint{
+		path: path,
+		state: checkpointState{
+			Version:    checkpointVersion,
+			Targets:    targets,
+			Ports:      ports,
+			Dictionary: dictionary,
+			Phases:     make(map[string][]string),
+			Positions:  make(map[string]map[string]int),
+			scanned:    make(map[string]bool),
+		},
+	}
+	if !resume {
+		return c, nil
+	}
+
+	_, err = fs.Stat(path)
+	if err != nil {
+		fmt.Printf("No checkpoint found in %q, starting a new scan\n", path)
+		return c, nil
+	}
+
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open checkpoint file %q: %v", path, err)
+	}
+	defer file.Close()
+
+	bytes, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint file %q: %v", path, err)
+	}
+
+	var state checkpointState
+	err = json.Unmarshal(bytes, &state)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint file %q: %v", path, err)
+	}
+
+	if state.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d in %q", state.Version, path)
+	}
+	if !slices.Equal(state.Targets, targets) || !slices.Equal(state.Ports, ports) {
+		return nil, fmt.Errorf("checkpoint file %q was saved for other targets or ports", path)
+	}
+	if state.Dictionary != dictionary {
+		return nil, fmt.Errorf("checkpoint file %q was saved for another credentials dictionary", path)
+	}
+
+	if state.Phases == nil {
+		state.Phases = make(map[string][]string)
+	}
+	if state.Positions == nil {
+		state.Positions = make(map[string]map[string]int)
+	}
+	state.scanned = make(map[string]bool, len(state.ScannedHosts))
+	for _, host := range state.ScannedHosts {
+		state.scanned[host] = true
+	}
+	c.state = state
+
+	fmt.Printf("Resuming scan from %q with %d scanned hosts and %d streams\n", path, len(state.ScannedHosts), len(state.Streams))
+	return c, nil
+}
+
+// dictionaryHash returns the hash of the credentials dictionary, which
+// tells whether a checkpoint was saved while trying the same credentials.
+func dictionaryHash(credentials Credentials) (string, error) {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash credentials dictionary: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// autosave saves the checkpoint periodically until the returned function is
+// called, which saves it one last time.
+func (c *checkpoint) autosave(ctx context.Context) func() {
+	if c == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.save()
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		c.save()
+	}
+}
+
+// save writes the checkpoint to its file if it changed since it was last
+// saved. The file is replaced at once, so that it is never left half written,
+// and only its owner can read it, since it holds the credentials found.
+func (c *checkpoint) save() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dirty {
+		return
+	}
+
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		fmt.Printf("Unable to save checkpoint: %v\n", err)
+		return
+	}
+
+	tmpPath := c.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0o600)
+	if err == nil {
+		err = os.Rename(tmpPath, c.path)
+	}
+	if err != nil {
+		fmt.Printf("Unable to save checkpoint to %q: %v\n", c.path, err)
+		return
+	}
+
+	c.dirty = false
+}
+
+// scanDone returns whether every port of every target was already scanned.
+func (c *checkpoint) scanDone() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state.ScanDone
+}
+
+// hostScanned returns whether every port of the host was already scanned.
+func (c *checkpoint) hostScanned(host string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state.scanned[host]
+}
+
+// setHostScanned records that every port of the host was scanned.
+func (c *checkpoint) setHostScanned(host string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state.scanned[host] = true
+	c.state.ScannedHosts = append(c.state.ScannedHosts, host)
+	c.dirty = true
+}
+
+// setScanDone records that every port of every target was scanned.
+func (c *checkpoint) setScanDone() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state.ScanDone = true
+	c.state.ScannedHosts = nil
+	c.dirty = true
+}
+
+// streams returns the streams saved in the checkpoint.
+func (c *checkpoint) streams() []Stream {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.state.Streams)
+}
+
+// updateStreams saves the streams in the checkpoint, adding the ones that
+// it did not hold yet.
+func (c *checkpoint) updateStreams(streams ...Stream) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, stream := range streams {
+		stream.Media = description.Session{}
+		stream.RouteResults = slices.Clone(stream.RouteResults)
+		for i := range stream.RouteResults {
+			stream.RouteResults[i].Media = description.Session{}
+		}
+
+		i := slices.IndexFunc(c.state.Streams, func(saved Stream) bool {
+			return saved.Address == stream.Address && saved.Port == stream.Port
+		})
+		if i < 0 {
+			c.state.Streams = append(c.state.Streams, stream)
+		} else {
+			c.state.Streams[i] = stream
+		}
+	}
+	c.dirty = true
+}
+
+// pending returns the streams which did not complete the attack phase yet.
+func (c *checkpoint) pending(streams []Stream, phase string) []Stream {
+	if c == nil {
+		return streams
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var pending []Stream
+	for _, stream := range streams {
+		if !slices.Contains(c.state.Phases[streamHost(stream)], phase) {
+			pending = append(pending, stream)
+		}
+	}
+	return pending
+}
+
+// setPhaseDone records that the streams completed the attack phase.
+func (c *checkpoint) setPhaseDone(streams []Stream, phase string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, stream := range streams {
+		key := streamHost(stream)
+		if !slices.Contains(c.state.Phases[key], phase) {
+			c.state.Phases[key] = append(c.state.Phases[key], phase)
+		}
+	}
+	c.dirty = true
+}
+
+// position returns the amount of credentials of the dictionary that were
+// already tried against the only route of the stream.
+func (c *checkpoint) position(stream Stream) int {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state.Positions[streamHost(stream)][stream.Route()]
+}
+
+// setPosition records the amount of credentials of the dictionary that were
+// tried against the only route of the stream.
+func (c *checkpoint) setPosition(stream Stream, position int) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := streamHost(stream)
+	if c.state.Positions[key] == nil {
+		c.state.Positions[key] = make(map[string]int)
+	}
+	c.state.Positions[key][stream.Route()] = position
+	c.dirty = true
+}
+
+// dictionaryProgress tracks the amount of credentials of the dictionary that
+// were tried in a row from its start, although they are tried concurrently
+// and thus do not complete in order.
+type dictionaryProgress struct {
+	mutex    sync.Mutex
+	position int
+	tried    map[int]bool
+}
+
+func newDictionaryProgress(position int) *dictionaryProgress {
+	return &dictionaryProgress{position: position, tried: make(map[int]bool)}
+}
+
+// done records that the credentials at the given position of the dictionary,
+// starting at 1, were tried, and returns the new position of the progress.
+func (p *dictionaryProgress) done(index int) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.tried[index] = true
+	for p.tried[p.position+1] {
+		delete(p.tried, p.position+1)
+		p.position++
+	}
+	return p.position
+}
@@ -0,0 +1,120 @@
+package cameradar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDictionaryProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		start int
+		done  []int
+		want  []int
+	}{
+		{
+			name: "in order",
+			done: []int{1, 2, 3},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "out of order",
+			done: []int{2, 3, 1, 5, 4},
+			want: []int{0, 0, 3, 3, 5},
+		},
+		{
+			name:  "resumed",
+			start: 10,
+			done:  []int{12, 11, 13},
+			want:  []int{10, 12, 13},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			progress := newDictionaryProgress(test.start)
+			for i, index := range test.done {
+				if got := progress.done(index); got != test.want[i] {
+					t.Errorf("done(%d) = %d, want %d", index, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.json")
+	targets := []string{"192.168.1.0/24"}
+	ports := []string{"554"}
+	credentials := Credentials{Usernames: []string{"admin"}, Passwords: []string{"", "12345"}}
+
+	saved, err := openCheckpoint(path, false, targets, ports, credentials)
+	if err != nil {
+		t.Fatalf("openCheckpoint() error = %v", err)
+	}
+
+	stream := Stream{Address: "192.168.1.10", Port: 554, Routes: []string{"live"}, CredentialsFound: true, Username: "admin", Password: "12345"}
+	other := Stream{Address: "192.168.1.11", Port: 554}
+	saved.setHostScanned("192.168.1.10")
+	saved.updateStreams(stream, other)
+	saved.setPhaseDone([]Stream{stream}, phaseCredentials)
+	saved.setPosition(other, 7)
+	saved.save()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("checkpoint file was not saved: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("checkpoint file mode = %o, want %o", mode, 0o600)
+	}
+
+	resumed, err := openCheckpoint(path, true, targets, ports, credentials)
+	if err != nil {
+		t.Fatalf("openCheckpoint() of the saved scan error = %v", err)
+	}
+	if !resumed.hostScanned("192.168.1.10") || resumed.hostScanned("192.168.1.11") {
+		t.Error("hostScanned() does not match the saved scan")
+	}
+	if got := resumed.streams(); len(got) != 2 || got[0].Password != "12345" {
+		t.Errorf("streams() = %+v, want the saved streams", got)
+	}
+	if got := resumed.pending([]Stream{stream, other}, phaseCredentials); len(got) != 1 || got[0].Address != other.Address {
+		t.Errorf("pending() = %+v, want only %s", got, other.Address)
+	}
+	if got := resumed.position(other); got != 7 {
+		t.Errorf("position() = %d, want 7", got)
+	}
+
+	mismatches := []struct {
+		name        string
+		targets     []string
+		ports       []string
+		credentials Credentials
+	}{
+		{name: "targets", targets: []string{"10.0.0.0/24"}, ports: ports, credentials: credentials},
+		{name: "ports", targets: targets, ports: []string{"8554"}, credentials: credentials},
+		{name: "credentials", targets: targets, ports: ports, credentials: Credentials{Usernames: []string{"admin"}, Passwords: []string{"12345", ""}}},
+	}
+	for _, mismatch := range mismatches {
+		_, err := openCheckpoint(path, true, mismatch.targets, mismatch.ports, mismatch.credentials)
+		if err == nil {
+			t.Errorf("openCheckpoint() resumed a scan with other %s", mismatch.name)
+		}
+	}
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	var c *checkpoint
+	streams := []Stream{{Address: "192.168.1.10", Port: 554}}
+
+	c.setHostScanned("192.168.1.10")
+	c.setPosition(streams[0], 3)
+	if c.hostScanned("192.168.1.10") || c.position(streams[0]) != 0 || c.scanDone() {
+		t.Error("nil checkpoint saved the progress of the scan")
+	}
+	if got := c.pending(streams, phaseRoutes); len(got) != 1 || got[0].Address != streams[0].Address {
+		t.Errorf("pending() = %+v, want every stream", got)
+	}
+	c.autosave(t.Context())()
+}
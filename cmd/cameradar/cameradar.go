@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Ullaakut/cameradar/v5"
@@ -18,12 +23,30 @@ func parseArguments() error {
 
 	pflag.StringSliceP("targets", "t", []string{}, "The targets on which to scan for open RTSP streams - required (ex: 172.16.100.0/24)")
 	pflag.StringSliceP("ports", "p", []string{"554", "5554", "8554"}, "The ports on which to search for RTSP streams")
-	pflag.StringP("custom-routes", "r", "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/routes", "The path on which to load a custom routes dictionary")
-	pflag.StringP("custom-credentials", "c", "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/credentials.json", "The path on which to load a custom credentials JSON dictionary")
-	pflag.StringP("output-file", "o", "", "Output scan results as a JSON file. If not specified, results are not written to a file.")
-	pflag.IntP("scan-speed", "s", 4, "The nmap speed preset to use for scanning (lower is stealthier)")
+	pflag.StringP("custom-routes", "r", "", "The path on which to load a custom routes dictionary. If not specified, the built-in dictionary is used.")
+	pflag.StringP("custom-credentials", "c", "", "The path on which to load a custom credentials JSON dictionary. If not specified, the built-in dictionary is used.")
+	pflag.Bool("extend-dictionaries", false, "Use custom dictionaries in addition to the built-in ones instead of replacing them")
+	pflag.StringP("output-file", "o", "", "Output scan results into a file. If not specified, results are not written to a file.")
+	pflag.String("output-format", "", "The format of the output file: json, csv or markdown. If not specified, it is guessed from the extension of the output file, and defaults to json.")
+	pflag.String("redact", "none", "Which credentials to redact from the output file and the events: none, passwords or all")
+	pflag.String("events", "", "Write each discovery as a line of JSON into this file as soon as it is made, or to the standard output if set to -")
+	pflag.Int("output-schema", 1, "The version of the schema of the output file: 1 (an array of streams) or 2 (with the results of each route of the streams)")
+	pflag.String("checkpoint", "", "Periodically save the state of the scan into this file, so that it can be resumed if it gets interrupted")
+	pflag.Bool("resume", false, "Resume the scan saved in the checkpoint file instead of starting a new one")
+	pflag.IntP("scan-speed", "s", 4, "The speed preset to use for scanning, from 1 to 5 (lower is stealthier)")
 	pflag.DurationP("attack-interval", "I", 0, "The interval between each attack  (i.e: 2000ms, higher is stealthier)")
+	pflag.Int("host-concurrency", 4, "The amount of attack attempts made at the same time against each host (lower is stealthier)")
+	pflag.Int("global-concurrency", 200, "The amount of attack attempts made at the same time against all hosts")
+	pflag.Duration("lockout-backoff", 5*time.Second, "The first pause of the attack of a host that starts refusing credential attempts, which doubles each time it refuses them again (i.e: 5s)")
+	pflag.String("route-discovery", "all", "Which routes to look for: first (stop at the first route found), all (every route of the dictionary), or per-channel (a route for each channel)")
 	pflag.DurationP("timeout", "T", 2000*time.Millisecond, "The timeout to use for attack attempts (i.e: 2000ms)")
+	pflag.Duration("validation-window", 10*time.Second, "The time during which streams need to send frames to be considered available (i.e: 10s)")
+	pflag.Int("validation-frames", 10, "The amount of frames to receive for a stream to be considered available, unless a keyframe is received first")
+	pflag.Bool("snapshots", false, "Save the first keyframe of each accessible stream next to the output file, or in the current directory if there is none")
+	pflag.String("recording-dir", "", "Record each accessible stream into its own file in this directory. If not specified, streams are not recorded.")
+	pflag.String("recording-format", "ts", "The container of stream recordings, either ts (MPEG-TS) or mp4 (fragmented MP4)")
+	pflag.Duration("recording-duration", 30*time.Second, "The duration of each stream recording (i.e: 30s, 0 for no limit)")
+	pflag.Int64("recording-max-size", 0, "The size in bytes after which each stream recording stops (0 for no limit)")
 	pflag.BoolP("debug", "d", false, "Enable the debug logs")
 	pflag.BoolP("verbose", "v", false, "Enable the verbose logs")
 	pflag.BoolP("help", "h", false, "displays this help message")
@@ -44,6 +67,7 @@ func parseArguments() error {
 		fmt.Println("\tScanning a remote camera on a specific port:\tcameradar -t 172.178.10.14 -p 18554 -s 2")
 		fmt.Println("\tScanning an unstable remote network: \t\tcameradar -t 172.178.10.14/24 -s 1 --timeout 10000 -l")
 		fmt.Println("\tStealthily scanning a remote network: \t\tcameradar -t 172.178.10.14/24 -s 1 -I 5000")
+		fmt.Println("\tResuming an interrupted scan: \t\t\tcameradar -t 172.16.0.0/16 --checkpoint scan.json --resume")
 		os.Exit(0)
 	}
 
@@ -62,6 +86,36 @@ func main() {
 		os.Exit(-1)
 	}
 
+	// Snapshots are saved next to the JSON report.
+	var snapshotDir string
+	if viper.GetBool("snapshots") {
+		snapshotDir = filepath.Dir(viper.GetString("output-file"))
+	}
+
+	// Discoveries are streamed as JSON Lines. When they are written to the
+	// standard output, the logs are written to the standard error instead
+	// so that the events can be piped.
+	var events io.Writer
+	switch path := viper.GetString("events"); path {
+	case "":
+	case "-":
+		events = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			fmt.Printf("Unable to open events file %s: %v\n", path, err)
+			os.Exit(-1)
+		}
+		defer file.Close()
+		events = file
+	}
+
+	outputFormat := viper.GetString("output-format")
+	if outputFormat == "" {
+		outputFormat = cameradar.ReportFormatFromPath(viper.GetString("output-file"))
+	}
+
 	c, err := cameradar.New(
 		//cameradar.WithClient(new gortsplib.),
 		cameradar.WithTargets(viper.GetStringSlice("targets")),
@@ -70,36 +124,66 @@ func main() {
 		cameradar.WithVerbose(viper.GetBool("verbose")),
 		cameradar.WithCustomCredentials(viper.GetString("custom-credentials")),
 		cameradar.WithCustomRoutes(viper.GetString("custom-routes")),
+		cameradar.WithExtendDictionaries(viper.GetBool("extend-dictionaries")),
 		cameradar.WithScanSpeed(viper.GetInt("scan-speed")),
 		cameradar.WithAttackInterval(viper.GetDuration("attack-interval")),
+		cameradar.WithHostConcurrency(viper.GetInt("host-concurrency")),
+		cameradar.WithGlobalConcurrency(viper.GetInt("global-concurrency")),
+		cameradar.WithLockoutBackoff(viper.GetDuration("lockout-backoff")),
+		cameradar.WithEvents(events),
+		cameradar.WithOutputFormat(outputFormat),
+		cameradar.WithRedaction(viper.GetString("redact")),
+		cameradar.WithOutputSchema(viper.GetInt("output-schema")),
+		cameradar.WithRouteDiscovery(viper.GetString("route-discovery")),
+		cameradar.WithCheckpoint(viper.GetString("checkpoint")),
+		cameradar.WithResume(viper.GetBool("resume")),
 		cameradar.WithTimeout(viper.GetDuration("timeout")),
+		cameradar.WithValidationWindow(viper.GetDuration("validation-window")),
+		cameradar.WithValidationFrames(viper.GetInt("validation-frames")),
+		cameradar.WithSnapshots(snapshotDir),
+		cameradar.WithRecording(viper.GetString("recording-dir")),
+		cameradar.WithRecordingFormat(viper.GetString("recording-format")),
+		cameradar.WithRecordingDuration(viper.GetDuration("recording-duration")),
+		cameradar.WithRecordingMaxSize(viper.GetInt64("recording-max-size")),
 	)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
 
-	scanResult, err := c.ScanHosts()
-	if err != nil {
+	// Interrupting cameradar stops the scan and attacks, but still outputs
+	// the results that were found until then.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scanResult, err := c.ScanHostsContext(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
-	//c.
-	streams, err := c.Attack(scanResult)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+
+	streams := scanResult
+	if ctx.Err() == nil {
+		streams, err = c.AttackContext(ctx, scanResult)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted, the following results are partial")
 	}
 
 	if path := viper.GetString("output-file"); path != "" {
 		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
-			fmt.Errorf("opening output file %s: %w", path, err)
-		}
-
-		err = c.Write(file, streams)
-		if err != nil {
-			fmt.Errorf("writing to output file %s: %w", path, err)
+			fmt.Printf("Unable to open output file %s: %v\n", path, err)
+		} else {
+			err = c.Write(file, streams)
+			if err != nil {
+				fmt.Printf("Unable to write to output file %s: %v\n", path, err)
+			}
 		}
 	}
 
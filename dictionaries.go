@@ -0,0 +1,15 @@
+package cameradar
+
+import _ "embed"
+
+// defaultCredentials is the built-in credentials dictionary, used when
+// no custom dictionary is given.
+//
+//go:embed dictionaries/credentials.json
+var defaultCredentials string
+
+// defaultRoutes is the built-in routes dictionary, used when no custom
+// dictionary is given.
+//
+//go:embed dictionaries/routes
+var defaultRoutes string
@@ -0,0 +1,83 @@
+package cameradar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types, in the order in which they are discovered for a stream.
+const (
+	eventPortOpen         = "port_open"
+	eventRTSPConfirmed    = "rtsp_confirmed"
+	eventRouteFound       = "route_found"
+	eventCredentialsFound = "credentials_found"
+	eventStreamValidated  = "stream_validated"
+)
+
+// event is a discovery made during the scan, which is emitted as a line of
+// JSON as soon as it is made, so that the progress of long scans can be
+// followed and their partial results ingested.
+type event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Address string    `json:"address"`
+	Port    uint16    `json:"port"`
+
+	Device          string        `json:"device,omitempty"`
+	Server          string        `json:"server,omitempty"`
+	Route           *string       `json:"route,omitempty"`
+	Username        string        `json:"username,omitempty"`
+	Password        string        `json:"password,omitempty"`
+	ValidationCodec string        `json:"validation_codec,omitempty"`
+	FirstFrameDelay time.Duration `json:"first_frame_delay,omitempty"`
+}
+
+// eventWriter writes events as JSON Lines. When events
+// are disabled, the eventWriter is nil and discards them.
+type eventWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	// redaction is the mode with which the credentials of
+	// events are redacted, as in the output file.
+	redaction string
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	if w == nil {
+		return nil
+	}
+	return &eventWriter{encoder: json.NewEncoder(w)}
+}
+
+// emit writes the event of the given type about the stream.
+func (e *eventWriter) emit(eventType string, stream Stream, details event) {
+	if e == nil {
+		return
+	}
+
+	details.Time = time.Now()
+	details.Type = eventType
+	details.Address = stream.Address
+	details.Port = stream.Port
+	if e.redaction != redactNone && e.redaction != "" {
+		redactCredentials(&details.Username, &details.Password, e.redaction)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// The encoder ends each event with a newline.
+	err := e.encoder.Encode(details)
+	if err != nil {
+		fmt.Printf("Unable to write %s event: %v\n", eventType, err)
+	}
+}
+
+// eventRoute returns the route of an event, which is
+// set even for the empty route.
+func eventRoute(route string) *string {
+	return &route
+}
@@ -0,0 +1,96 @@
+package cameradar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEventWriter(t *testing.T) {
+	var out bytes.Buffer
+	events := newEventWriter(&out)
+	stream := Stream{Address: "192.168.1.10", Port: 554}
+
+	events.emit(eventRouteFound, stream, event{Route: eventRoute("")})
+	events.emit(eventCredentialsFound, stream, event{Route: eventRoute("live"), Username: "admin", Password: "12345"})
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line map[string]any
+		err := json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			t.Fatalf("event %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("emit() wrote %d lines, want 2", len(lines))
+	}
+
+	tests := []struct {
+		key  string
+		want []any
+	}{
+		{key: "type", want: []any{eventRouteFound, eventCredentialsFound}},
+		{key: "address", want: []any{"192.168.1.10", "192.168.1.10"}},
+		{key: "port", want: []any{554.0, 554.0}},
+		// The empty route is written, since it is the route of the stream.
+		{key: "route", want: []any{"", "live"}},
+		{key: "username", want: []any{nil, "admin"}},
+	}
+	for _, test := range tests {
+		for i, line := range lines {
+			if line[test.key] != test.want[i] {
+				t.Errorf("event %d %s = %v, want %v", i, test.key, line[test.key], test.want[i])
+			}
+		}
+	}
+	if _, ok := lines[0]["time"]; !ok {
+		t.Error("event has no time")
+	}
+
+	// Disabled events are discarded.
+	var disabled *eventWriter
+	disabled.emit(eventPortOpen, stream, event{})
+	if newEventWriter(nil) != nil {
+		t.Error("newEventWriter(nil) is not nil")
+	}
+}
+
+func TestEventWriterRedaction(t *testing.T) {
+	tests := []struct {
+		mode         string
+		username     string
+		password     string
+		wantUsername any
+		wantPassword any
+	}{
+		{mode: redactNone, username: "admin", password: "12345", wantUsername: "admin", wantPassword: "12345"},
+		{mode: redactPasswords, username: "admin", password: "12345", wantUsername: "admin", wantPassword: redactedValue},
+		{mode: redactAll, username: "admin", password: "12345", wantUsername: redactedValue, wantPassword: redactedValue},
+		// Empty credentials are not redacted, and are left out of the event.
+		{mode: redactAll, username: "admin", wantUsername: redactedValue},
+		{mode: redactAll},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			var out bytes.Buffer
+			events := newEventWriter(&out)
+			events.redaction = test.mode
+
+			stream := Stream{Address: "192.168.1.10", Port: 554}
+			events.emit(eventCredentialsFound, stream, event{Route: eventRoute("live"), Username: test.username, Password: test.password})
+
+			var line map[string]any
+			err := json.Unmarshal(out.Bytes(), &line)
+			if err != nil {
+				t.Fatalf("event %q is not JSON: %v", out.String(), err)
+			}
+			if line["username"] != test.wantUsername || line["password"] != test.wantPassword {
+				t.Errorf("event credentials = %v:%v, want %v:%v", line["username"], line["password"], test.wantUsername, test.wantPassword)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package cameradar
+
+import (
+	"slices"
+	"strings"
+)
+
+// vendorFingerprint identifies the vendor of a device from the RTSP responses
+// it sends, and lists the routes that its devices usually expose.
+type vendorFingerprint struct {
+	vendor string
+	// patterns are lowercase strings that are looked for in the Server
+	// header of the device's responses, or in its authentication realm.
+	patterns []string
+	routes   []string
+}
+
+// fingerprints are the known vendors, in the order in which they are matched.
+var fingerprints = []vendorFingerprint{
+	{
+		vendor:   "Hikvision",
+		patterns: []string{"hikvision", "hik-connect", "dnvrs-webs"},
+		routes:   []string{"Streaming/Channels/101", "Streaming/Channels/1", "h264/ch1/main/av_stream"},
+	},
+	{
+		vendor:   "Dahua",
+		patterns: []string{"dahua", "login to "},
+		routes:   []string{"cam/realmonitor?channel=1&subtype=0", "cam/realmonitor?channel=1&subtype=1"},
+	},
+	{
+		vendor:   "Amcrest",
+		patterns: []string{"amcrest"},
+		routes:   []string{"cam/realmonitor?channel=1&subtype=0", "cam/realmonitor?channel=1&subtype=1"},
+	},
+	{
+		vendor:   "Axis",
+		patterns: []string{"axis"},
+		routes:   []string{"axis-media/media.amp", "axis-media/media.amp?videocodec=h264"},
+	},
+	{
+		vendor:   "Ubiquiti",
+		patterns: []string{"ubiquiti", "ubnt", "unifi"},
+		routes:   []string{"live/ch00_0", "s0"},
+	},
+	{
+		vendor:   "Reolink",
+		patterns: []string{"reolink"},
+		routes:   []string{"h264Preview_01_main", "h264Preview_01_sub"},
+	},
+	{
+		vendor:   "Foscam",
+		patterns: []string{"foscam"},
+		routes:   []string{"videoMain", "videoSub"},
+	},
+	{
+		vendor:   "Samsung",
+		patterns: []string{"samsung", "hanwha", "wisenet"},
+		routes:   []string{"profile2/media.smp", "profile5/media.smp"},
+	},
+	{
+		vendor:   "Vivotek",
+		patterns: []string{"vivotek"},
+		routes:   []string{"live.sdp"},
+	},
+	{
+		vendor:   "Bosch",
+		patterns: []string{"bosch", "dinion"},
+		routes:   []string{"rtsp_tunnel", "video1"},
+	},
+	{
+		vendor:   "Mobotix",
+		patterns: []string{"mobotix"},
+		routes:   []string{"mobotix.h264", "mobotix.mjpeg"},
+	},
+	{
+		vendor:   "Sony",
+		patterns: []string{"sony"},
+		routes:   []string{"media/video1"},
+	},
+	{
+		vendor:   "Panasonic",
+		patterns: []string{"panasonic"},
+		routes:   []string{"MediaInput/h264", "MediaInput/mpeg4"},
+	},
+	{
+		vendor:   "GStreamer",
+		patterns: []string{"gstreamer"},
+		routes:   []string{"test"},
+	},
+	{
+		vendor:   "Live555",
+		patterns: []string{"live555"},
+	},
+}
+
+// fingerprintVendor returns the vendor whose patterns are found in the given
+// banner or realm, or an empty string if the vendor is unknown.
+func fingerprintVendor(text string) string {
+	text = strings.ToLower(text)
+	if text == "" {
+		return ""
+	}
+
+	for _, fingerprint := range fingerprints {
+		for _, pattern := range fingerprint.patterns {
+			if strings.Contains(text, pattern) {
+				return fingerprint.vendor
+			}
+		}
+	}
+	return ""
+}
+
+// fingerprintServer returns the vendor identified by the Server header
+// of the server's response, or by the realm of its authentication challenges.
+func fingerprintServer(info ServerInfo) string {
+	if vendor := fingerprintVendor(info.Server); vendor != "" {
+		return vendor
+	}
+
+	return fingerprintRealms(parseAuthChallenges(info.WWWAuthenticate))
+}
+
+// fingerprintRealms returns the vendor identified by the realm
+// of the authentication challenges.
+func fingerprintRealms(challenges []AuthInfo) string {
+	for _, challenge := range challenges {
+		if vendor := fingerprintVendor(challenge.Realm); vendor != "" {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// forVendor returns the routes with the known routes of the vendor first.
+func (r Routes) forVendor(vendor string) Routes {
+	index := slices.IndexFunc(fingerprints, func(f vendorFingerprint) bool {
+		return strings.EqualFold(f.vendor, vendor)
+	})
+	if index < 0 || len(fingerprints[index].routes) == 0 {
+		return r
+	}
+
+	vendorRoutes := fingerprints[index].routes
+	routes := make(Routes, 0, len(vendorRoutes)+len(r))
+	routes = append(routes, vendorRoutes...)
+	for _, route := range r {
+		if !slices.Contains(vendorRoutes, route) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// forVendor returns the credentials with the pairs of the vendor first.
+func (c Credentials) forVendor(vendor string) Credentials {
+	if vendor == "" {
+		return c
+	}
+
+	pairs := make([]CredentialPair, 0, len(c.Pairs))
+	for _, pair := range c.Pairs {
+		if strings.EqualFold(pair.Vendor, vendor) {
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, pair := range c.Pairs {
+		if !strings.EqualFold(pair.Vendor, vendor) {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	c.Pairs = pairs
+	return c
+}
@@ -0,0 +1,152 @@
+package cameradar
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFingerprintVendor(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Hikvision-Webs", want: "Hikvision"},
+		{text: "DNVRS-Webs", want: "Hikvision"},
+		{text: "Dahua Rtsp Server", want: "Dahua"},
+		{text: "Login to 4L01234PAZ", want: "Dahua"},
+		{text: "AXIS Media Server", want: "Axis"},
+		{text: "UBNT Streaming Server", want: "Ubiquiti"},
+		{text: "GStreamer RTSP server", want: "GStreamer"},
+		{text: "LIVE555 Streaming Media v2020.08.19", want: "Live555"},
+		{text: "Wisenet", want: "Samsung"},
+		{text: "Rtsp Server/3.0"},
+		{text: "IP Camera"},
+		{text: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := fingerprintVendor(test.text); got != test.want {
+				t.Errorf("fingerprintVendor(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintServer(t *testing.T) {
+	tests := []struct {
+		name string
+		info ServerInfo
+		want string
+	}{
+		{
+			name: "server header",
+			info: ServerInfo{Server: "Hikvision-Webs"},
+			want: "Hikvision",
+		},
+		{
+			name: "server header first",
+			info: ServerInfo{Server: "Axis", WWWAuthenticate: []string{`Basic realm="Login to 4L01234PAZ"`}},
+			want: "Axis",
+		},
+		{
+			name: "realm of an unknown server",
+			info: ServerInfo{Server: "Rtsp Server/3.0", WWWAuthenticate: []string{`Digest realm="IP Camera", nonce="1"`, `Basic realm="Login to 4L01234PAZ"`}},
+			want: "Dahua",
+		},
+		{
+			name: "unknown",
+			info: ServerInfo{Server: "Rtsp Server/3.0", WWWAuthenticate: []string{`Basic realm="IP Camera"`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fingerprintServer(test.info); got != test.want {
+				t.Errorf("fingerprintServer() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoutesForVendor(t *testing.T) {
+	routes := Routes{"live.sdp", "Streaming/Channels/1", "media.amp"}
+
+	tests := []struct {
+		vendor string
+		want   Routes
+	}{
+		{
+			vendor: "Hikvision",
+			want:   Routes{"Streaming/Channels/101", "Streaming/Channels/1", "h264/ch1/main/av_stream", "live.sdp", "media.amp"},
+		},
+		{
+			vendor: "vivotek",
+			want:   Routes{"live.sdp", "Streaming/Channels/1", "media.amp"},
+		},
+		// Live555 has no routes of its own.
+		{vendor: "Live555", want: routes},
+		{vendor: "Unknown", want: routes},
+		{vendor: "", want: routes},
+	}
+	for _, test := range tests {
+		t.Run(test.vendor, func(t *testing.T) {
+			got := routes.forVendor(test.vendor)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("forVendor(%q) = %q, want %q", test.vendor, got, test.want)
+			}
+		})
+	}
+
+	if !slices.Equal(routes, Routes{"live.sdp", "Streaming/Channels/1", "media.amp"}) {
+		t.Errorf("forVendor() modified the routes: %q", routes)
+	}
+}
+
+func TestCredentialsForVendor(t *testing.T) {
+	credentials := Credentials{
+		Pairs: []CredentialPair{
+			{Username: "admin", Password: "admin"},
+			{Vendor: "Dahua", Username: "admin", Password: "admin123"},
+			{Vendor: "Hikvision", Username: "admin", Password: "12345"},
+			{Vendor: "dahua", Username: "888888", Password: "888888"},
+		},
+		Usernames: []string{"root"},
+		Passwords: []string{"root"},
+	}
+
+	tests := []struct {
+		vendor string
+		want   [][2]string
+	}{
+		{
+			vendor: "Dahua",
+			want:   [][2]string{{"admin", "admin123"}, {"888888", "888888"}, {"admin", "admin"}, {"admin", "12345"}, {"root", "root"}},
+		},
+		{
+			vendor: "hikvision",
+			want:   [][2]string{{"admin", "12345"}, {"admin", "admin"}, {"admin", "admin123"}, {"888888", "888888"}, {"root", "root"}},
+		},
+		{
+			vendor: "Unknown",
+			want:   [][2]string{{"admin", "admin"}, {"admin", "admin123"}, {"admin", "12345"}, {"888888", "888888"}, {"root", "root"}},
+		},
+		{
+			vendor: "",
+			want:   [][2]string{{"admin", "admin"}, {"admin", "admin123"}, {"admin", "12345"}, {"888888", "888888"}, {"root", "root"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.vendor, func(t *testing.T) {
+			var got [][2]string
+			for username, password := range credentials.forVendor(test.vendor).attempts() {
+				got = append(got, [2]string{username, password})
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("forVendor(%q) attempts = %q, want %q", test.vendor, got, test.want)
+			}
+		})
+	}
+
+	if credentials.Pairs[0].Vendor != "" || credentials.Pairs[2].Vendor != "Hikvision" {
+		t.Errorf("forVendor() reordered the pairs of the dictionary: %+v", credentials.Pairs)
+	}
+}
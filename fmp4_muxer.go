@@ -0,0 +1,380 @@
+package cameradar
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+)
+
+// fmp4VideoTimeScale is the time scale of video tracks, which is
+// the clock rate of H264 and H265 timestamps.
+const fmp4VideoTimeScale = 90000
+
+// fmp4Muxer allows to save a H264 or H265 stream into a fragmented MP4 file,
+// along with audio tracks. A fragment is written for each group of pictures.
+type fmp4Muxer struct {
+	fileName    string
+	h265        bool
+	vps         []byte
+	sps         []byte
+	pps         []byte
+	audioTracks []*fmp4Track
+
+	mutex            sync.Mutex
+	f                *os.File
+	b                *bufio.Writer
+	c                *countingWriter
+	video            *fmp4Track
+	started          bool
+	startDTS         int64
+	sequenceNumber   uint32
+	h264DTSExtractor *h264.DTSExtractor
+	h265DTSExtractor *h265.DTSExtractor
+}
+
+// fmp4Track is a track of a fmp4Muxer. Since the duration of a sample is only
+// known once the next one is received, the last sample is kept pending.
+type fmp4Track struct {
+	id        int
+	timeScale int64
+	codec     mp4.Codec
+
+	samples    []*fmp4.Sample
+	baseTime   int64
+	pending    *fmp4.Sample
+	pendingDTS int64
+}
+
+// push adds a sample decoded at the given time, relative to the start of the recording.
+func (t *fmp4Track) push(sample *fmp4.Sample, dts int64) {
+	t.flush(dts)
+	t.pending = sample
+	t.pendingDTS = dts
+}
+
+// flush adds the pending sample to the samples of the next fragment, ending
+// it at the given time, which is the one of the sample that follows it.
+func (t *fmp4Track) flush(dts int64) {
+	if t.pending == nil {
+		return
+	}
+
+	t.pending.Duration = uint32(max(dts-t.pendingDTS, 0))
+	if len(t.samples) == 0 {
+		t.baseTime = t.pendingDTS
+	}
+	t.samples = append(t.samples, t.pending)
+	t.pending = nil
+}
+
+// initialize initializes a fmp4Muxer.
+func (e *fmp4Muxer) initialize() error {
+	var err error
+	e.f, err = os.Create(e.fileName)
+	if err != nil {
+		return err
+	}
+	e.b = bufio.NewWriter(e.f)
+	e.c = &countingWriter{w: e.b}
+
+	e.video = &fmp4Track{
+		id:        1,
+		timeScale: fmp4VideoTimeScale,
+	}
+
+	return nil
+}
+
+// addAudioTrack adds a track for the audio format to the muxer, and returns
+// its index. It returns false if fMP4 cannot carry the format.
+// It needs to be called before initialize.
+func (e *fmp4Muxer) addAudioTrack(forma format.Format) (int, bool) {
+	var codec mp4.Codec
+	switch forma := forma.(type) {
+	case *format.MPEG4Audio:
+		if forma.Config == nil {
+			return 0, false
+		}
+		codec = &mp4.CodecMPEG4Audio{Config: *forma.Config}
+
+	case *format.Opus:
+		codec = &mp4.CodecOpus{ChannelCount: forma.ChannelCount}
+
+	default:
+		return 0, false
+	}
+
+	e.audioTracks = append(e.audioTracks, &fmp4Track{
+		// The video track has the first ID.
+		id:        len(e.audioTracks) + 2,
+		timeScale: int64(forma.ClockRate()),
+		codec:     codec,
+	})
+	return len(e.audioTracks) - 1, true
+}
+
+// close writes the remaining samples and closes all the fmp4Muxer resources.
+func (e *fmp4Muxer) close() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.started {
+		for _, track := range e.tracks() {
+			if track.pending == nil {
+				continue
+			}
+
+			// Give the last sample the same duration as the previous one.
+			if len(track.samples) > 0 {
+				track.pending.Duration = track.samples[len(track.samples)-1].Duration
+			}
+			if len(track.samples) == 0 {
+				track.baseTime = track.pendingDTS
+			}
+			track.samples = append(track.samples, track.pending)
+			track.pending = nil
+		}
+
+		e.writePart() //nolint:errcheck
+	}
+
+	e.b.Flush() //nolint:errcheck
+	e.f.Close()
+}
+
+// size returns the amount of bytes written so far.
+func (e *fmp4Muxer) size() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.c.n
+}
+
+func (e *fmp4Muxer) tracks() []*fmp4Track {
+	return append([]*fmp4Track{e.video}, e.audioTracks...)
+}
+
+// writeInit writes the initialization segment, once the video
+// parameters are known.
+func (e *fmp4Muxer) writeInit() error {
+	if e.h265 {
+		e.video.codec = &mp4.CodecH265{VPS: e.vps, SPS: e.sps, PPS: e.pps}
+	} else {
+		e.video.codec = &mp4.CodecH264{SPS: e.sps, PPS: e.pps}
+	}
+
+	var init fmp4.Init
+	for _, track := range e.tracks() {
+		init.Tracks = append(init.Tracks, &fmp4.InitTrack{
+			ID:        track.id,
+			TimeScale: uint32(track.timeScale),
+			Codec:     track.codec,
+		})
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.c.Write(buf.Bytes())
+	return err
+}
+
+// writePart writes the samples of all tracks into a fragment.
+func (e *fmp4Muxer) writePart() error {
+	part := fmp4.Part{SequenceNumber: e.sequenceNumber}
+	for _, track := range e.tracks() {
+		if len(track.samples) == 0 {
+			continue
+		}
+
+		part.Tracks = append(part.Tracks, &fmp4.PartTrack{
+			ID:       track.id,
+			BaseTime: uint64(track.baseTime),
+			Samples:  track.samples,
+		})
+		track.samples = nil
+	}
+
+	if len(part.Tracks) == 0 {
+		return nil
+	}
+	e.sequenceNumber++
+
+	var buf seekablebuffer.Buffer
+	err := part.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.c.Write(buf.Bytes())
+	return err
+}
+
+// writeVideo writes a H264 or H265 access unit into the fMP4 file.
+func (e *fmp4Muxer) writeVideo(au [][]byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var randomAccess bool
+	if e.h265 {
+		randomAccess = e.updateH265Params(au)
+	} else {
+		randomAccess = e.updateH264Params(au)
+	}
+
+	if !e.started {
+		// skip samples silently until we find a random access one
+		// and the video parameters are known
+		if !randomAccess || e.sps == nil || e.pps == nil || (e.h265 && e.vps == nil) {
+			return nil
+		}
+
+		err := e.writeInit()
+		if err != nil {
+			return err
+		}
+
+		if e.h265 {
+			e.h265DTSExtractor = &h265.DTSExtractor{}
+			e.h265DTSExtractor.Initialize()
+		} else {
+			e.h264DTSExtractor = &h264.DTSExtractor{}
+			e.h264DTSExtractor.Initialize()
+		}
+	}
+
+	var dts int64
+	var err error
+	if e.h265 {
+		dts, err = e.h265DTSExtractor.Extract(au, pts)
+	} else {
+		dts, err = e.h264DTSExtractor.Extract(au, pts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !e.started {
+		e.started = true
+		e.startDTS = dts
+	}
+
+	// start a new fragment on each random access access unit, ending the
+	// previous one with the last access unit of its group of pictures
+	if randomAccess {
+		e.video.flush(dts - e.startDTS)
+		err = e.writePart()
+		if err != nil {
+			return err
+		}
+	}
+
+	e.video.push(&fmp4.Sample{
+		PTSOffset:       int32(pts - dts),
+		IsNonSyncSample: !randomAccess,
+		Payload:         avccMarshal(au),
+	}, dts-e.startDTS)
+
+	return nil
+}
+
+// updateH264Params keeps track of the SPS and PPS sent in the stream,
+// and returns whether the access unit contains a keyframe.
+func (e *fmp4Muxer) updateH264Params(au [][]byte) bool {
+	for _, nalu := range au {
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			e.sps = nalu
+		case h264.NALUTypePPS:
+			e.pps = nalu
+		}
+	}
+	return containsIDR(au)
+}
+
+// updateH265Params keeps track of the VPS, SPS and PPS sent in the stream,
+// and returns whether the access unit contains a keyframe.
+func (e *fmp4Muxer) updateH265Params(au [][]byte) bool {
+	for _, nalu := range au {
+		switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+		case h265.NALUType_VPS_NUT:
+			e.vps = nalu
+		case h265.NALUType_SPS_NUT:
+			e.sps = nalu
+		case h265.NALUType_PPS_NUT:
+			e.pps = nalu
+		}
+	}
+	return containsIRAP(au)
+}
+
+// audioDTS returns the timestamp of an audio sample relative to the start
+// of the recording, and false if it was sent before the recording started.
+func (e *fmp4Muxer) audioDTS(track *fmp4Track, pts int64) (int64, bool) {
+	if !e.started {
+		return 0, false
+	}
+
+	dts := pts - multiplyAndDivide(e.startDTS, track.timeScale, fmp4VideoTimeScale)
+	return dts, dts >= 0
+}
+
+// writeMPEG4Audio writes MPEG-4 Audio access units into the fMP4 file.
+func (e *fmp4Muxer) writeMPEG4Audio(track int, aus [][]byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	audio := e.audioTracks[track]
+	dts, ok := e.audioDTS(audio, pts)
+	if !ok {
+		return nil
+	}
+
+	for i, au := range aus {
+		audio.push(&fmp4.Sample{Payload: au}, dts+int64(i*mpeg4audio.SamplesPerAccessUnit))
+	}
+	return nil
+}
+
+// writeOpus writes an Opus packet into the fMP4 file.
+func (e *fmp4Muxer) writeOpus(track int, packet []byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	audio := e.audioTracks[track]
+	dts, ok := e.audioDTS(audio, pts)
+	if !ok {
+		return nil
+	}
+
+	audio.push(&fmp4.Sample{Payload: packet}, dts)
+	return nil
+}
+
+// avccMarshal encodes an access unit into the AVCC format used by MP4,
+// in which each NAL unit is prefixed with its length.
+func avccMarshal(au [][]byte) []byte {
+	n := 0
+	for _, nalu := range au {
+		n += 4 + len(nalu)
+	}
+
+	buf := make([]byte, 0, n)
+	for _, nalu := range au {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(nalu)))
+		buf = append(buf, nalu...)
+	}
+	return buf
+}
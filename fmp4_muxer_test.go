@@ -0,0 +1,43 @@
+package cameradar
+
+import (
+	"testing"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+)
+
+func TestFMP4TrackFragmentsStartWithSyncSamples(t *testing.T) {
+	track := &fmp4Track{id: 1, timeScale: fmp4VideoTimeScale}
+
+	// A group of pictures of an IDR followed by two P-frames.
+	track.push(&fmp4.Sample{}, 0)
+	track.push(&fmp4.Sample{IsNonSyncSample: true}, 3000)
+	track.push(&fmp4.Sample{IsNonSyncSample: true}, 6000)
+
+	// The muxer ends the fragment with the last P-frame once the next IDR
+	// is received, before it pushes the IDR.
+	track.flush(9000)
+	fragment := track.samples
+	track.samples = nil
+	track.push(&fmp4.Sample{}, 9000)
+
+	if len(fragment) != 3 {
+		t.Fatalf("fragment has %d samples, want 3", len(fragment))
+	}
+	if fragment[0].IsNonSyncSample {
+		t.Error("fragment starts with a non-sync sample")
+	}
+	for i, sample := range fragment {
+		if sample.Duration != 3000 {
+			t.Errorf("sample %d lasts %d, want 3000", i, sample.Duration)
+		}
+	}
+
+	track.push(&fmp4.Sample{IsNonSyncSample: true}, 12000)
+	if len(track.samples) != 1 || track.samples[0].IsNonSyncSample {
+		t.Fatalf("next fragment starts with %+v, want the IDR", track.samples)
+	}
+	if track.baseTime != 9000 {
+		t.Errorf("next fragment starts at %d, want 9000", track.baseTime)
+	}
+}
@@ -1,6 +1,15 @@
 package cameradar
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5"
+)
 
 func replace(streams []Stream, new Stream) []Stream {
 	var updatedSlice []Stream
@@ -16,12 +25,76 @@ func replace(streams []Stream, new Stream) []Stream {
 	return updatedSlice
 }
 
+// sleep waits for the given duration, or until the context is canceled,
+// in which case it returns the context's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startClient starts the given RTSP client and makes sure that it gets closed
+// as soon as the context is canceled, so that any pending request is aborted.
+// The returned function closes the client and must be called once it is no
+// longer used.
+func startClient(ctx context.Context, client *gortsplib.Client) (func(), error) {
+	err := client.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, client.Close)
+	return func() {
+		stop()
+		client.Close()
+	}, nil
+}
+
+// streamHost returns the host:port pair of a stream, with IPv6 addresses
+// enclosed in brackets.
+func streamHost(stream Stream) string {
+	return net.JoinHostPort(stream.Address, strconv.Itoa(int(stream.Port)))
+}
+
+// streamFileName returns the name of a file holding data of a stream, based
+// on its address, port and route.
+func streamFileName(stream Stream, extension string) string {
+	name := fmt.Sprintf("%s_%d", stream.Address, stream.Port)
+	if route := strings.Trim(stream.Route(), "/"); route != "" {
+		name += "_" + route
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	return name + "." + extension
+}
+
 // GetCameraRTSPURL generates a stream's RTSP URL.
 func GetCameraRTSPURL(stream Stream) string {
-	return "rtsp://" + stream.Username + ":" + stream.Password + "@" + stream.Address + ":" + fmt.Sprint(stream.Port) + "/" + stream.Route()
+	return "rtsp://" + stream.Username + ":" + stream.Password + "@" + streamHost(stream) + "/" + stream.Route()
 }
 
 // GetCameraAdminPanelURL returns the URL to the camera's admin panel.
 func GetCameraAdminPanelURL(stream Stream) string {
+	if strings.Contains(stream.Address, ":") {
+		return "http://[" + stream.Address + "]/"
+	}
 	return "http://" + stream.Address + "/"
 }
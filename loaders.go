@@ -32,28 +32,61 @@ type osFS struct{}
 func (osFS) Open(name string) (file, error)        { return os.Open(name) }
 func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 
-// LoadCredentials opens a dictionary file and returns its contents as a Credentials structure.
+// LoadCredentials loads the credentials dictionary. The dictionary embedded in
+// the binary is used if no custom dictionary path was given, and if custom
+// dictionaries extend the built-in ones, they are merged together.
 func (s *Scanner) LoadCredentials() error {
+	builtin, err := ParseCredentialsFromString(defaultCredentials)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal built-in dictionary contents: %v", err)
+	}
+
+	if s.credentialDictionaryPath == "" {
+		fmt.Println("Loading built-in credentials dictionary")
+		s.credentials = builtin
+		s.printCredentialsCount()
+		return nil
+	}
+
 	fmt.Printf("Loading credentials dictionary from path %q\n", s.credentialDictionaryPath)
 
-	// Open & Read XML file.
 	content, err := os.ReadFile(s.credentialDictionaryPath)
 	if err != nil {
 		return fmt.Errorf("could not read credentials dictionary file at %q: %v", s.credentialDictionaryPath, err)
 	}
 
-	// Unmarshal content of JSON file into data structure.
-	err = json.Unmarshal(content, &s.credentials)
+	s.credentials, err = ParseCredentialsFromString(string(content))
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal dictionary contents: %v", err)
+		return fmt.Errorf("unable to parse dictionary contents: %v", err)
+	}
+
+	if s.extendDictionaries {
+		s.credentials = Credentials{
+			Pairs:     append(s.credentials.Pairs, builtin.Pairs...),
+			Usernames: mergeEntries(s.credentials.Usernames, builtin.Usernames),
+			Passwords: mergeEntries(s.credentials.Passwords, builtin.Passwords),
+		}
 	}
 
-	fmt.Printf("Loaded %d usernames and %d passwords\n", len(s.credentials.Usernames), len(s.credentials.Passwords))
+	s.printCredentialsCount()
 	return nil
 }
 
-// LoadRoutes opens a dictionary file and returns its contents as a Routes structure.
+func (s *Scanner) printCredentialsCount() {
+	fmt.Printf("Loaded %d credential pairs, %d usernames and %d passwords\n", len(s.credentials.Pairs), len(s.credentials.Usernames), len(s.credentials.Passwords))
+}
+
+// LoadRoutes loads the routes dictionary. The dictionary embedded in the
+// binary is used if no custom dictionary path was given, and if custom
+// dictionaries extend the built-in ones, they are merged together.
 func (s *Scanner) LoadRoutes() error {
+	if s.routeDictionaryPath == "" {
+		fmt.Println("Loading built-in routes dictionary")
+		s.routes = ParseRoutesFromString(defaultRoutes)
+		fmt.Printf("Loaded %d routes\n", len(s.routes))
+		return nil
+	}
+
 	fmt.Printf("Loading routes dictionary from path %q\n", s.routeDictionaryPath)
 
 	file, err := os.Open(s.routeDictionaryPath)
@@ -66,16 +99,31 @@ func (s *Scanner) LoadRoutes() error {
 	for scanner.Scan() {
 		s.routes = append(s.routes, scanner.Text())
 	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if s.extendDictionaries {
+		s.routes = mergeEntries(s.routes, ParseRoutesFromString(defaultRoutes))
+	}
 
 	fmt.Printf("Loaded %d routes\n", len(s.routes))
 
-	return scanner.Err()
+	return nil
 }
 
 // ParseCredentialsFromString parses a dictionary string and returns its contents as a Credentials structure.
+// The dictionary is either a JSON object holding credential pairs and lists of
+// usernames and passwords, or a list of username:password pairs, one per line.
+// In the latter, pairs can be grouped under [vendor] lines, and lines starting
+// with # are ignored.
 func ParseCredentialsFromString(content string) (Credentials, error) {
 	var creds Credentials
 
+	if !strings.HasPrefix(strings.TrimSpace(content), "{") {
+		return parseCredentialPairs(content)
+	}
+
 	// Unmarshal content of JSON file into data structure.
 	err := json.Unmarshal([]byte(content), &creds)
 	if err != nil {
@@ -85,9 +133,58 @@ func ParseCredentialsFromString(content string) (Credentials, error) {
 	return creds, nil
 }
 
+func parseCredentialPairs(content string) (Credentials, error) {
+	var creds Credentials
+
+	var vendor string
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			vendor = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+
+		username, password, ok := strings.Cut(line, ":")
+		if !ok {
+			return creds, fmt.Errorf("line %d: expected username:password, got %q", i+1, line)
+		}
+
+		creds.Pairs = append(creds.Pairs, CredentialPair{
+			Vendor:   vendor,
+			Username: username,
+			Password: password,
+		})
+	}
+
+	return creds, nil
+}
+
 // ParseRoutesFromString parses a dictionary string and returns its contents as a Routes structure.
 func ParseRoutesFromString(content string) Routes {
-	return strings.Split(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// mergeEntries appends the entries of extra that are not in entries yet.
+func mergeEntries[T ~[]string](entries, extra T) T {
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		seen[entry] = struct{}{}
+	}
+
+	for _, entry := range extra {
+		if _, ok := seen[entry]; ok {
+			continue
+		}
+		seen[entry] = struct{}{}
+		entries = append(entries, entry)
+	}
+
+	return entries
 }
 
 // LoadTargets parses the file containing hosts to targets, if the targets are
@@ -0,0 +1,165 @@
+package cameradar
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseCredentialsFromString(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Credentials
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			content: `{"pairs": [{"vendor": "hikvision", "username": "admin", "password": "12345"}], "usernames": ["admin", "root"], "passwords": ["", "admin"]}`,
+			want: Credentials{
+				Pairs:     []CredentialPair{{Vendor: "hikvision", Username: "admin", Password: "12345"}},
+				Usernames: []string{"admin", "root"},
+				Passwords: []string{"", "admin"},
+			},
+		},
+		{
+			name:    "json with leading blank lines",
+			content: "\n  {\"usernames\": [\"admin\"], \"passwords\": [\"admin\"]}\n",
+			want:    Credentials{Usernames: []string{"admin"}, Passwords: []string{"admin"}},
+		},
+		{
+			name:    "malformed json",
+			content: `{"usernames": [`,
+			wantErr: true,
+		},
+		{
+			name:    "pairs",
+			content: "admin:admin\nroot:\n:12345\nuser:pa:ss\n",
+			want: Credentials{Pairs: []CredentialPair{
+				{Username: "admin", Password: "admin"},
+				{Username: "root", Password: ""},
+				{Username: "", Password: "12345"},
+				{Username: "user", Password: "pa:ss"},
+			}},
+		},
+		{
+			name:    "comments, blank lines and CRLF",
+			content: "# Default credentials\r\n\r\nadmin:admin\r\n   \r\n  # indented comment\r\nroot:root\r\n",
+			want: Credentials{Pairs: []CredentialPair{
+				{Username: "admin", Password: "admin"},
+				{Username: "root", Password: "root"},
+			}},
+		},
+		{
+			name:    "vendor sections",
+			content: "admin:admin\n[Hikvision]\nadmin:12345\n[ dahua ]\nadmin:admin\n888888:888888\n",
+			want: Credentials{Pairs: []CredentialPair{
+				{Username: "admin", Password: "admin"},
+				{Vendor: "Hikvision", Username: "admin", Password: "12345"},
+				{Vendor: "dahua", Username: "admin", Password: "admin"},
+				{Vendor: "dahua", Username: "888888", Password: "888888"},
+			}},
+		},
+		{
+			name:    "line without separator",
+			content: "admin:admin\nroot\n",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed vendor section",
+			content: "[hikvision\nadmin:12345\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseCredentialsFromString(test.content)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseCredentialsFromString() error = %v, want error: %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseCredentialsFromString() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials Credentials
+		want        [][2]string
+	}{
+		{
+			name: "usernames and passwords",
+			credentials: Credentials{
+				Usernames: []string{"admin", "root"},
+				Passwords: []string{"", "admin"},
+			},
+			want: [][2]string{{"admin", ""}, {"admin", "admin"}, {"root", ""}, {"root", "admin"}},
+		},
+		{
+			name: "pairs first without duplicates",
+			credentials: Credentials{
+				Pairs: []CredentialPair{
+					{Vendor: "hikvision", Username: "admin", Password: "12345"},
+					{Vendor: "dahua", Username: "admin", Password: "admin"},
+					{Vendor: "axis", Username: "admin", Password: "12345"},
+				},
+				Usernames: []string{"admin", "root"},
+				Passwords: []string{"admin", "12345"},
+			},
+			want: [][2]string{{"admin", "12345"}, {"admin", "admin"}, {"root", "admin"}, {"root", "12345"}},
+		},
+		{
+			name:        "empty",
+			credentials: Credentials{Usernames: []string{"admin"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][2]string
+			for username, password := range test.credentials.attempts() {
+				got = append(got, [2]string{username, password})
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("attempts() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// Attempts stop as soon as they are not wanted anymore.
+	credentials := Credentials{Usernames: []string{"admin", "root"}, Passwords: []string{"admin"}}
+	for username := range credentials.attempts() {
+		if username != "admin" {
+			t.Errorf("attempts() yielded %q after the first attempt", username)
+		}
+		break
+	}
+}
+
+func TestMergeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		extra   []string
+		want    []string
+	}{
+		{name: "disjoint", entries: []string{"a", "b"}, extra: []string{"c"}, want: []string{"a", "b", "c"}},
+		{name: "overlapping", entries: []string{"a", "b"}, extra: []string{"b", "c", "a"}, want: []string{"a", "b", "c"}},
+		{name: "duplicated extra", entries: []string{"a"}, extra: []string{"c", "c", ""}, want: []string{"a", "c", ""}},
+		{name: "empty entries", extra: []string{"a"}, want: []string{"a"}},
+		{name: "empty extra", entries: []string{"a"}, want: []string{"a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mergeEntries(slices.Clone(test.entries), test.extra)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("mergeEntries(%q, %q) = %q, want %q", test.entries, test.extra, got, test.want)
+			}
+		})
+	}
+}
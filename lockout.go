@@ -0,0 +1,208 @@
+package cameradar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+)
+
+// Lockout states, which tell whether the server of a stream started refusing
+// credential attempts during the attack.
+const (
+	// lockoutRateLimited servers refused attempts for a while, so the attack
+	// was paused before it carried on.
+	lockoutRateLimited = "rate_limited"
+	// lockoutLocked servers kept refusing attempts after every pause, so the
+	// attack was given up before every credential was tried.
+	lockoutLocked = "locked_out"
+)
+
+const (
+	// defaultLockoutBackoff is the first pause of the attack of a host that
+	// refuses attempts. It doubles each time the host refuses them again.
+	defaultLockoutBackoff = 5 * time.Second
+	// maxLockoutPauses is the amount of pauses in a row after which a host
+	// that still refuses attempts is considered locked out.
+	maxLockoutPauses = 4
+
+	// latencyBaselineAttempts is the amount of rejected attempts whose
+	// latency is the baseline against which slower answers are detected.
+	latencyBaselineAttempts = 5
+	// latencyFactor is how many times slower than the baseline the server
+	// needs to answer for its answers to be considered throttled.
+	latencyFactor = 4
+	// minLockoutLatency is the latency under which answers are never
+	// considered throttled, since the latency of fast servers varies a lot.
+	minLockoutLatency = time.Second
+)
+
+// attemptResult is the outcome of a credential attempt.
+type attemptResult struct {
+	ok    bool
+	media description.Session
+	// res is the response of the server, or nil if it did not answer.
+	res     *base.Response
+	err     error
+	start   time.Time
+	latency time.Duration
+}
+
+// lockoutDetector watches the outcome of the credential attempts against a
+// stream, and pauses the attack of its host when the server starts refusing
+// attempts regardless of the credentials.
+type lockoutDetector struct {
+	scanner *Scanner
+	stream  Stream
+
+	mutex sync.Mutex
+	// challenge is the first challenge with which credentials were rejected.
+	challenge  *AuthInfo
+	rejections int
+	baseline   time.Duration
+	pauses     int
+	pausedAt   time.Time
+	state      string
+	reason     string
+}
+
+func newLockoutDetector(scanner *Scanner, stream Stream) *lockoutDetector {
+	return &lockoutDetector{scanner: scanner, stream: stream}
+}
+
+// observe records the outcome of an attempt, and pauses the attack of the
+// host when the attempt shows that the server refuses attempts. It returns
+// whether the credentials of the attempt need to be tried again, since the
+// server did not check them, and whether the attack needs to stop since
+// the server is locked out.
+func (d *lockoutDetector) observe(result attemptResult) (retry, stop bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.state == lockoutLocked {
+		return false, true
+	}
+
+	reason, retry := d.signal(result)
+
+	// Attempts which were sent before the last pause do not tell whether
+	// the server still refuses attempts after it.
+	if result.start.Before(d.pausedAt) {
+		return retry, false
+	}
+
+	if reason == "" {
+		d.pauses = 0
+		return false, false
+	}
+
+	d.reason = reason
+	if d.pauses >= maxLockoutPauses {
+		d.state = lockoutLocked
+		fmt.Printf("Stream %s is locked out (%s), giving up its credential attack\n", streamHost(d.stream), reason)
+		return false, true
+	}
+
+	pause := d.scanner.lockoutBackoff << d.pauses
+	d.pauses++
+	d.pausedAt = time.Now()
+	d.state = lockoutRateLimited
+	d.scanner.scheduler.pause(d.stream.Address, pause)
+
+	fmt.Printf("Stream %s refuses attempts (%s), pausing its attack for %v\n", streamHost(d.stream), reason, pause)
+	return retry, false
+}
+
+// signal returns why the attempt shows that the server refuses attempts
+// regardless of the credentials, if it does, and whether the credentials
+// of the attempt were not checked.
+func (d *lockoutDetector) signal(result attemptResult) (string, bool) {
+	if result.ok {
+		return "", false
+	}
+
+	if result.res == nil {
+		if isConnectionRefused(result.err) {
+			return fmt.Sprintf("connection refused: %v", result.err), true
+		}
+		return "", false
+	}
+
+	switch result.res.StatusCode {
+	case base.StatusServiceUnavailable, statusTooManyRequests:
+		return fmt.Sprintf("%d %s", result.res.StatusCode, result.res.StatusMessage), true
+	case base.StatusForbidden:
+		// Servers which rejected credentials until now do
+		// not forbid the access for a wrong password.
+		if d.rejections > 0 {
+			return fmt.Sprintf("%d %s after rejecting credentials", result.res.StatusCode, result.res.StatusMessage), true
+		}
+	case base.StatusUnauthorized:
+		return d.rejected(result)
+	}
+	return "", false
+}
+
+// rejected records an attempt whose credentials were rejected, and returns
+// why it shows that the server refuses attempts, if it does.
+func (d *lockoutDetector) rejected(result attemptResult) (string, bool) {
+	challenges := parseAuthChallenges(result.res.Header["WWW-Authenticate"])
+	challenge, ok := supportedChallenge(challenges)
+	switch {
+	case !ok && d.challenge != nil:
+		return "server stopped sending authentication challenges", true
+	case !ok:
+	case d.challenge == nil:
+		d.challenge = &challenge
+	case challenge.Type != d.challenge.Type || challenge.Realm != d.challenge.Realm:
+		return fmt.Sprintf("authentication changed from %s realm %q to %s realm %q", d.challenge.Type, d.challenge.Realm, challenge.Type, challenge.Realm), true
+	case challenge.Stale:
+		// Attempts are made again once with a new nonce when it expired,
+		// so servers whose new nonces expire right away refuse attempts.
+		return "server keeps expiring its nonces", true
+	}
+
+	d.rejections++
+	if d.rejections <= latencyBaselineAttempts {
+		d.baseline += (result.latency - d.baseline) / time.Duration(d.rejections)
+		return "", false
+	}
+
+	if result.latency > minLockoutLatency && result.latency > d.baseline*latencyFactor {
+		return fmt.Sprintf("answers slowed down from %v to %v", d.baseline.Round(time.Millisecond), result.latency.Round(time.Millisecond)), false
+	}
+	return "", false
+}
+
+// locked returns whether the server is locked out.
+func (d *lockoutDetector) locked() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.state == lockoutLocked
+}
+
+// report writes the lockout state of the server into the stream.
+func (d *lockoutDetector) report(stream *Stream) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	stream.LockoutState = d.state
+	stream.LockoutReason = d.reason
+}
+
+// statusTooManyRequests is not part of RTSP, but some servers borrow it
+// from HTTP to rate limit clients.
+const statusTooManyRequests base.StatusCode = 429
+
+// isConnectionRefused returns whether the error is the server refusing or
+// closing the connection, as servers which lock clients out often do.
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,216 @@
+package cameradar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+)
+
+// rejection returns the result of an attempt rejected
+// with the given challenge, after the given latency.
+func rejection(challenge string, latency time.Duration) attemptResult {
+	res := &base.Response{StatusCode: base.StatusUnauthorized, Header: base.Header{}}
+	if challenge != "" {
+		res.Header["WWW-Authenticate"] = base.HeaderValue{challenge}
+	}
+	return attemptResult{res: res, latency: latency}
+}
+
+// status returns the result of an attempt answered with the status code.
+func status(code base.StatusCode) attemptResult {
+	return attemptResult{res: &base.Response{StatusCode: code, StatusMessage: "Status"}}
+}
+
+func TestLockoutDetectorSignal(t *testing.T) {
+	const challenge = `Digest realm="cam", nonce="1"`
+
+	baseline := make([]attemptResult, latencyBaselineAttempts)
+	for i := range baseline {
+		baseline[i] = rejection(challenge, 10*time.Millisecond)
+	}
+
+	tests := []struct {
+		name string
+		// before are the attempts observed before the one tested.
+		before     []attemptResult
+		result     attemptResult
+		wantReason bool
+		wantRetry  bool
+	}{
+		{
+			name:   "accepted credentials",
+			result: attemptResult{ok: true, res: &base.Response{StatusCode: base.StatusOK}},
+		},
+		{
+			name:   "rejected credentials",
+			result: rejection(challenge, 10*time.Millisecond),
+		},
+		{
+			name:       "connection refused",
+			result:     attemptResult{err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED)},
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:   "timeout",
+			result: attemptResult{err: os.ErrDeadlineExceeded},
+		},
+		{
+			name:       "service unavailable",
+			result:     status(base.StatusServiceUnavailable),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:       "too many requests",
+			result:     status(statusTooManyRequests),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:   "forbidden from the start",
+			result: status(base.StatusForbidden),
+		},
+		{
+			name:       "forbidden after rejecting credentials",
+			before:     []attemptResult{rejection(challenge, 0)},
+			result:     status(base.StatusForbidden),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:   "new nonce",
+			before: []attemptResult{rejection(challenge, 0)},
+			result: rejection(`Digest realm="cam", nonce="2"`, 0),
+		},
+		{
+			name:       "realm change",
+			before:     []attemptResult{rejection(challenge, 0)},
+			result:     rejection(`Digest realm="locked", nonce="1"`, 0),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:       "authentication type change",
+			before:     []attemptResult{rejection(challenge, 0)},
+			result:     rejection(`Basic realm="cam"`, 0),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:       "challenges stop",
+			before:     []attemptResult{rejection(challenge, 0)},
+			result:     rejection("", 0),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:       "expiring nonces",
+			before:     []attemptResult{rejection(challenge, 0)},
+			result:     rejection(`Digest realm="cam", nonce="2", stale=true`, 0),
+			wantReason: true,
+			wantRetry:  true,
+		},
+		{
+			name:       "slower answers",
+			before:     baseline,
+			result:     rejection(challenge, 2*time.Second),
+			wantReason: true,
+		},
+		{
+			name:   "slightly slower answers",
+			before: baseline,
+			result: rejection(challenge, 30*time.Millisecond),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detector := newLockoutDetector(newTestScanner(1), Stream{Address: "127.0.0.1", Port: 554})
+			for _, result := range test.before {
+				if reason, _ := detector.signal(result); reason != "" {
+					t.Fatalf("signal() of a previous attempt = %q", reason)
+				}
+			}
+
+			reason, retry := detector.signal(test.result)
+			if (reason != "") != test.wantReason || retry != test.wantRetry {
+				t.Errorf("signal() = %q, %t, want a reason: %t, retry: %t", reason, retry, test.wantReason, test.wantRetry)
+			}
+		})
+	}
+}
+
+func TestLockoutDetectorObserve(t *testing.T) {
+	stream := Stream{Address: "127.0.0.1", Port: 554}
+	detector := newLockoutDetector(newTestScanner(1), stream)
+
+	refused := func() attemptResult {
+		result := status(base.StatusServiceUnavailable)
+		result.start = time.Now()
+		return result
+	}
+
+	// Accepted attempts reset the amount of pauses in a row.
+	for range maxLockoutPauses {
+		detector.observe(refused())
+	}
+	detector.observe(attemptResult{ok: true, start: time.Now()})
+
+	for i := range maxLockoutPauses {
+		retry, stop := detector.observe(refused())
+		if !retry || stop {
+			t.Fatalf("observe() of refusal %d = %t, %t, want true, false", i+1, retry, stop)
+		}
+	}
+
+	var got Stream
+	detector.report(&got)
+	if got.LockoutState != lockoutRateLimited || got.LockoutReason == "" {
+		t.Errorf("report() = %q, %q, want %q with a reason", got.LockoutState, got.LockoutReason, lockoutRateLimited)
+	}
+
+	// Attempts sent before the last pause do not count.
+	retry, stop := detector.observe(status(base.StatusServiceUnavailable))
+	if !retry || stop {
+		t.Errorf("observe() of an attempt sent before the pause = %t, %t, want true, false", retry, stop)
+	}
+
+	_, stop = detector.observe(refused())
+	if !stop || !detector.locked() {
+		t.Fatalf("observe() after %d pauses did not lock the stream out", maxLockoutPauses)
+	}
+	detector.report(&got)
+	if got.LockoutState != lockoutLocked {
+		t.Errorf("report() state = %q, want %q", got.LockoutState, lockoutLocked)
+	}
+
+	_, stop = detector.observe(attemptResult{ok: true, start: time.Now()})
+	if !stop {
+		t.Error("observe() carried on after the stream was locked out")
+	}
+}
+
+func TestIsConnectionRefused(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: syscall.ECONNREFUSED, want: true},
+		{err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{err: fmt.Errorf("reading response: %w", io.EOF), want: true},
+		{err: errors.New("unexpected status"), want: false},
+		{err: os.ErrDeadlineExceeded, want: false},
+		{err: nil, want: false},
+	}
+	for _, test := range tests {
+		if got := isConnectionRefused(test.err); got != test.want {
+			t.Errorf("isConnectionRefused(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package cameradar
 
 import (
+	"iter"
+	"slices"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v5/pkg/description"
@@ -21,6 +23,150 @@ type Stream struct {
 
 	Media              description.Session `json:"media"`
 	AuthenticationType string              `json:"authentication_type"`
+	// RouteBehavior is how the stream's server answers requests for routes
+	// that do not exist: strict, accepts_any_route or auth_before_route.
+	RouteBehavior string `json:"route_behavior,omitempty"`
+	// AuthMethods are the authentication challenges offered by the
+	// stream, with their realm, digest algorithm and quality of protection.
+	AuthMethods []AuthInfo `json:"auth_methods,omitempty"`
+
+	// ServerInfo is the parsed response of the stream's
+	// server to the OPTIONS request sent during the scan.
+	ServerInfo ServerInfo `json:"server_info"`
+
+	// ValidationCodec is the codec of the media that proved
+	// that the stream is live during validation.
+	ValidationCodec string `json:"validation_codec"`
+	// FirstFrameDelay is how long the stream took to send its first
+	// access unit during validation.
+	FirstFrameDelay time.Duration `json:"first_frame_delay"`
+
+	// SnapshotPath is the path of the file into which the first
+	// keyframe of the stream was saved, if it was.
+	SnapshotPath string `json:"snapshot_path,omitempty"`
+	// RecordingPath is the path of the file into which
+	// the stream was recorded, if it was.
+	RecordingPath string `json:"recording_path,omitempty"`
+	// SkippedTracks are the codecs of the audio tracks that
+	// could not be recorded without transcoding.
+	SkippedTracks []string `json:"skipped_tracks,omitempty"`
+
+	// LockoutState tells whether the stream's server started refusing
+	// credential attempts during the attack: rate_limited if the attack
+	// was paused before it carried on, or locked_out if it was given up.
+	// LockoutReason is the last sign that the server refused attempts.
+	LockoutState  string `json:"lockout_state,omitempty"`
+	LockoutReason string `json:"lockout_reason,omitempty"`
+
+	// RouteResults are the results of the attack of each route, in the
+	// order of Routes. The fields of the stream hold the results of its
+	// first route, which is the one used to access the stream.
+	RouteResults []RouteResult `json:"route_results,omitempty"`
+}
+
+// RouteResult is the result of the attack of a single route of a stream,
+// since routes of a device can have different access rules, as the
+// channels of NVRs often do.
+type RouteResult struct {
+	Route              string              `json:"route"`
+	CredentialsFound   bool                `json:"credentials_found"`
+	Username           string              `json:"username"`
+	Password           string              `json:"password"`
+	AuthenticationType string              `json:"authentication_type"`
+	AuthMethods        []AuthInfo          `json:"auth_methods,omitempty"`
+	Available          bool                `json:"available"`
+	Media              description.Session `json:"media"`
+	ValidationCodec    string              `json:"validation_codec,omitempty"`
+	FirstFrameDelay    time.Duration       `json:"first_frame_delay,omitempty"`
+	SnapshotPath       string              `json:"snapshot_path,omitempty"`
+}
+
+// syncRouteResults makes sure that the stream has a result for each of its
+// routes, or for the empty route if it has none, keeping existing results.
+func (s *Stream) syncRouteResults() {
+	routes := s.Routes
+	if len(routes) == 0 {
+		routes = []string{""}
+	}
+
+	results := make([]RouteResult, len(routes))
+	for i, route := range routes {
+		results[i] = RouteResult{Route: route}
+		for _, result := range s.RouteResults {
+			if result.Route == route {
+				results[i] = result
+				break
+			}
+		}
+	}
+	s.RouteResults = results
+}
+
+// forRoute returns the stream as if the route of the result was its only
+// route, with the credentials and authentication found for that route, or
+// the ones of the stream if none were found for it.
+func (s Stream) forRoute(result RouteResult) Stream {
+	s.Routes = []string{result.Route}
+	s.RouteResults = nil
+	s.Available = false
+	s.ValidationCodec = ""
+	s.FirstFrameDelay = 0
+	s.SnapshotPath = ""
+	s.Media = result.Media
+
+	if result.CredentialsFound {
+		s.CredentialsFound = true
+		s.Username = result.Username
+		s.Password = result.Password
+	}
+	if result.AuthenticationType != "" {
+		s.AuthenticationType = result.AuthenticationType
+		s.AuthMethods = result.AuthMethods
+	}
+
+	return s
+}
+
+// setPrimaryRoute moves the route of the given index first, and copies its
+// results into the fields of the stream.
+func (s *Stream) setPrimaryRoute(i int) {
+	if i > 0 && i < len(s.Routes) {
+		route, result := s.Routes[i], s.RouteResults[i]
+		s.Routes = append([]string{route}, slices.Delete(slices.Clone(s.Routes), i, i+1)...)
+		s.RouteResults = append([]RouteResult{result}, slices.Delete(slices.Clone(s.RouteResults), i, i+1)...)
+	}
+
+	primary := s.RouteResults[0]
+	if primary.CredentialsFound {
+		s.CredentialsFound = true
+		s.Username = primary.Username
+		s.Password = primary.Password
+	}
+	if len(primary.Media.Medias) > 0 {
+		s.Media = primary.Media
+	}
+	if primary.AuthenticationType != "" {
+		s.AuthenticationType = primary.AuthenticationType
+		s.AuthMethods = primary.AuthMethods
+	}
+	s.Available = primary.Available
+	s.ValidationCodec = primary.ValidationCodec
+	s.FirstFrameDelay = primary.FirstFrameDelay
+	s.SnapshotPath = primary.SnapshotPath
+}
+
+// ServerInfo is what an RTSP server tells about itself
+// in its response to an OPTIONS request.
+type ServerInfo struct {
+	StatusCode    int    `json:"status_code"`
+	StatusMessage string `json:"status_message"`
+	CSeq          string `json:"cseq,omitempty"`
+	Server        string `json:"server,omitempty"`
+	// Methods are the methods listed in the Public header.
+	Methods []string `json:"methods,omitempty"`
+	// WWWAuthenticate are the authentication challenges
+	// that the server sent, if any.
+	WWWAuthenticate []string `json:"www_authenticate,omitempty"`
 }
 
 // Route returns this stream's route if there is one.
@@ -31,12 +177,53 @@ func (s Stream) Route() string {
 	return ""
 }
 
-// Credentials is a map of credentials
-// usernames are keys and passwords are values
-// creds['admin'] -> 'secure_password'
+// Credentials is a credentials dictionary. Known username and password
+// pairs are tried first, followed by every combination of the usernames
+// and passwords lists.
 type Credentials struct {
-	Usernames []string `json:"usernames"`
-	Passwords []string `json:"passwords"`
+	Pairs     []CredentialPair `json:"pairs,omitempty"`
+	Usernames []string         `json:"usernames"`
+	Passwords []string         `json:"passwords"`
+}
+
+// CredentialPair is a username and password that are used together,
+// usually as the default credentials of a vendor's devices.
+type CredentialPair struct {
+	Vendor   string `json:"vendor,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// attempts returns every username and password to try, starting with the
+// known pairs, and then every combination of usernames and passwords that
+// is not a known pair.
+func (c Credentials) attempts() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		tried := make(map[[2]string]struct{}, len(c.Pairs))
+		for _, pair := range c.Pairs {
+			key := [2]string{pair.Username, pair.Password}
+			if _, ok := tried[key]; ok {
+				continue
+			}
+			tried[key] = struct{}{}
+
+			if !yield(pair.Username, pair.Password) {
+				return
+			}
+		}
+
+		for _, username := range c.Usernames {
+			for _, password := range c.Passwords {
+				if _, ok := tried[[2]string{username, password}]; ok {
+					continue
+				}
+
+				if !yield(username, password) {
+					return
+				}
+			}
+		}
+	}
 }
 
 // Routes is a slice of Routes
@@ -2,23 +2,40 @@ package cameradar
 
 import (
 	"bufio"
+	"io"
 	"os"
+	"sync"
 
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
 	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
 )
 
-// mpegtsMuxer allows to save a H264 stream into a MPEG-TS file.
+// mpegtsMuxer allows to save a H264 or H265 stream into a MPEG-TS file,
+// along with audio tracks.
 type mpegtsMuxer struct {
-	fileName string
-	sps      []byte
-	pps      []byte
-
-	f            *os.File
-	b            *bufio.Writer
-	w            *mpegts.Writer
-	track        *mpegts.Track
-	dtsExtractor *h264.DTSExtractor
+	fileName    string
+	h265        bool
+	vps         []byte
+	sps         []byte
+	pps         []byte
+	audioTracks []*mpegtsAudioTrack
+
+	mutex            sync.Mutex
+	f                *os.File
+	b                *bufio.Writer
+	c                *countingWriter
+	w                *mpegts.Writer
+	track            *mpegts.Track
+	h264DTSExtractor *h264.DTSExtractor
+	h265DTSExtractor *h265.DTSExtractor
+}
+
+// mpegtsAudioTrack is an audio track of a mpegtsMuxer.
+type mpegtsAudioTrack struct {
+	track     *mpegts.Track
+	clockRate int64
 }
 
 // initialize initializes a mpegtsMuxer.
@@ -29,12 +46,21 @@ func (e *mpegtsMuxer) initialize() error {
 		return err
 	}
 	e.b = bufio.NewWriter(e.f)
+	e.c = &countingWriter{w: e.b}
 
 	e.track = &mpegts.Track{
 		Codec: &mpegts.CodecH264{},
 	}
+	if e.h265 {
+		e.track.Codec = &mpegts.CodecH265{}
+	}
 
-	e.w = &mpegts.Writer{W: e.b, Tracks: []*mpegts.Track{e.track}}
+	tracks := []*mpegts.Track{e.track}
+	for _, audio := range e.audioTracks {
+		tracks = append(tracks, audio.track)
+	}
+
+	e.w = &mpegts.Writer{W: e.c, Tracks: tracks}
 	err = e.w.Initialize()
 	if err != nil {
 		return err
@@ -43,12 +69,61 @@ func (e *mpegtsMuxer) initialize() error {
 	return nil
 }
 
+// addAudioTrack adds a track for the audio format to the muxer, and returns
+// its index. It returns false if MPEG-TS cannot carry the format.
+// It needs to be called before initialize.
+func (e *mpegtsMuxer) addAudioTrack(forma format.Format) (int, bool) {
+	var codec mpegts.Codec
+	switch forma := forma.(type) {
+	case *format.MPEG4Audio:
+		if forma.Config == nil {
+			return 0, false
+		}
+		codec = &mpegts.CodecMPEG4Audio{Config: *forma.Config}
+
+	case *format.Opus:
+		codec = &mpegts.CodecOpus{ChannelCount: forma.ChannelCount}
+
+	default:
+		return 0, false
+	}
+
+	e.audioTracks = append(e.audioTracks, &mpegtsAudioTrack{
+		track:     &mpegts.Track{Codec: codec},
+		clockRate: int64(forma.ClockRate()),
+	})
+	return len(e.audioTracks) - 1, true
+}
+
 // close closes all the mpegtsMuxer resources.
 func (e *mpegtsMuxer) close() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	e.b.Flush() //nolint:errcheck
 	e.f.Close()
 }
 
+// size returns the amount of bytes written so far.
+func (e *mpegtsMuxer) size() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.c.n
+}
+
+// writeVideo writes a H264 or H265 access unit into MPEG-TS,
+// depending on the codec of the muxer.
+func (e *mpegtsMuxer) writeVideo(au [][]byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.h265 {
+		return e.writeH265(au, pts)
+	}
+	return e.writeH264(au, pts)
+}
+
 // writeH264 writes a H264 access unit into MPEG-TS.
 func (e *mpegtsMuxer) writeH264(au [][]byte, pts int64) error {
 	var filteredAU [][]byte //nolint:prealloc
@@ -91,16 +166,16 @@ func (e *mpegtsMuxer) writeH264(au [][]byte, pts int64) error {
 		au = append([][]byte{e.sps, e.pps}, au...)
 	}
 
-	if e.dtsExtractor == nil {
+	if e.h264DTSExtractor == nil {
 		// skip samples silently until we find one with a IDR
 		if !idrPresent {
 			return nil
 		}
-		e.dtsExtractor = &h264.DTSExtractor{}
-		e.dtsExtractor.Initialize()
+		e.h264DTSExtractor = &h264.DTSExtractor{}
+		e.h264DTSExtractor.Initialize()
 	}
 
-	dts, err := e.dtsExtractor.Extract(au, pts)
+	dts, err := e.h264DTSExtractor.Extract(au, pts)
 	if err != nil {
 		return err
 	}
@@ -108,3 +183,101 @@ func (e *mpegtsMuxer) writeH264(au [][]byte, pts int64) error {
 	// encode into MPEG-TS
 	return e.w.WriteH264(e.track, pts, dts, au)
 }
+
+// writeH265 writes a H265 access unit into MPEG-TS.
+func (e *mpegtsMuxer) writeH265(au [][]byte, pts int64) error {
+	var filteredAU [][]byte //nolint:prealloc
+
+	randomAccess := false
+
+	for _, nalu := range au {
+		typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
+		switch typ {
+		case h265.NALUType_VPS_NUT:
+			e.vps = nalu
+			continue
+
+		case h265.NALUType_SPS_NUT:
+			e.sps = nalu
+			continue
+
+		case h265.NALUType_PPS_NUT:
+			e.pps = nalu
+			continue
+
+		case h265.NALUType_AUD_NUT:
+			continue
+		}
+
+		if containsIRAP([][]byte{nalu}) {
+			randomAccess = true
+		}
+
+		filteredAU = append(filteredAU, nalu)
+	}
+
+	au = filteredAU
+
+	if au == nil {
+		return nil
+	}
+
+	// add VPS, SPS and PPS before random access access units
+	if randomAccess {
+		if e.vps == nil || e.sps == nil || e.pps == nil {
+			return nil
+		}
+		au = append([][]byte{e.vps, e.sps, e.pps}, au...)
+	}
+
+	if e.h265DTSExtractor == nil {
+		// skip samples silently until we find a random access one
+		if !randomAccess {
+			return nil
+		}
+		e.h265DTSExtractor = &h265.DTSExtractor{}
+		e.h265DTSExtractor.Initialize()
+	}
+
+	dts, err := e.h265DTSExtractor.Extract(au, pts)
+	if err != nil {
+		return err
+	}
+
+	// encode into MPEG-TS
+	return e.w.WriteH265(e.track, pts, dts, au)
+}
+
+// writeMPEG4Audio writes MPEG-4 Audio access units into MPEG-TS.
+// The timestamp is expressed in the clock rate of the track, and gets
+// converted to the 90kHz MPEG-TS clock to align with the video.
+func (e *mpegtsMuxer) writeMPEG4Audio(track int, aus [][]byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	audio := e.audioTracks[track]
+	return e.w.WriteMPEG4Audio(audio.track, multiplyAndDivide(pts, 90000, audio.clockRate), aus)
+}
+
+// writeOpus writes an Opus packet into MPEG-TS.
+// The timestamp is expressed in the clock rate of the track, and gets
+// converted to the 90kHz MPEG-TS clock to align with the video.
+func (e *mpegtsMuxer) writeOpus(track int, packet []byte, pts int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	audio := e.audioTracks[track]
+	return e.w.WriteOpus(audio.track, multiplyAndDivide(pts, 90000, audio.clockRate), [][]byte{packet})
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,355 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5"
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// RecordStreams records each available stream into its own file in the
+// recording directory, and stores the path of the file in the stream.
+func (s *Scanner) RecordStreams(targets []Stream) []Stream {
+	return s.RecordStreamsContext(context.Background(), targets)
+}
+
+// RecordStreamsContext is like RecordStreams, but stops recording when the
+// context is canceled. Recordings that were in progress are kept.
+func (s *Scanner) RecordStreamsContext(ctx context.Context, targets []Stream) []Stream {
+	err := os.MkdirAll(s.recordingDir, 0o755)
+	if err != nil {
+		fmt.Printf("Unable to create recording directory %q: %v\n", s.recordingDir, err)
+		return targets
+	}
+
+	for i := range targets {
+		if !targets[i].Available {
+			continue
+		}
+
+		err := s.recordStream(ctx, &targets[i])
+		if err != nil {
+			fmt.Printf("Unable to record stream %s: %v\n", streamHost(targets[i]), err)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return targets
+}
+
+// recordStream plays the stream and writes it into a file until the recording
+// duration or size limit is reached.
+func (s *Scanner) recordStream(ctx context.Context, stream *Stream) error {
+	rawURL := fmt.Sprintf(
+		"rtsp://%s:%s@%s/%s",
+		stream.Username,
+		stream.Password,
+		streamHost(*stream),
+		stream.Route(),
+	)
+	recordURL, err := base.ParseURL(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing url %q: %w", rawURL, err)
+	}
+
+	client := &gortsplib.Client{
+		Scheme: recordURL.Scheme,
+		Host:   recordURL.Host,
+	}
+	closeClient, err := startClient(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	desc, _, err := client.Describe(recordURL)
+	if err != nil {
+		return err
+	}
+
+	medi, forma := findRecordingFormat(desc)
+	if medi == nil {
+		return errors.New("no recordable media found")
+	}
+
+	decode, err := newFrameDecoder(forma)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.recordingDir, streamFileName(*stream, s.recordingFormat))
+	muxer := newRecordingMuxer(s.recordingFormat, path, forma)
+
+	// Add a track for each audio media that the container can carry without
+	// transcoding, and report the other ones as skipped.
+	var audios []recordedAudio
+	stream.SkippedTracks = nil
+	for _, audioMedia := range desc.Medias {
+		if audioMedia.Type != description.MediaTypeAudio || len(audioMedia.Formats) == 0 {
+			continue
+		}
+
+		audioFormat := audioMedia.Formats[0]
+		track, ok := muxer.addAudioTrack(audioFormat)
+		if !ok {
+			stream.SkippedTracks = append(stream.SkippedTracks, audioFormat.Codec())
+			continue
+		}
+
+		audios = append(audios, recordedAudio{
+			media:  audioMedia,
+			format: audioFormat,
+			track:  track,
+		})
+	}
+
+	err = muxer.initialize()
+	if err != nil {
+		return err
+	}
+	// The client needs to be closed before the muxer, so that no
+	// packet gets written into a closed file.
+	defer func() {
+		closeClient()
+		muxer.close()
+	}()
+
+	_, err = client.Setup(desc.BaseURL, medi, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	full := make(chan struct{})
+	var fullOnce sync.Once
+	checkSize := func() {
+		if s.recordingMaxSize > 0 && muxer.size() >= s.recordingMaxSize {
+			fullOnce.Do(func() { close(full) })
+		}
+	}
+
+	client.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		pts, ok := client.PacketPTS(medi, pkt)
+		if !ok {
+			return
+		}
+
+		au, _, err := decode(pkt)
+		if err != nil {
+			if !isIncompleteFrame(err) {
+				log.Printf("ERR: %v", err)
+			}
+			return
+		}
+
+		err = muxer.writeVideo(au, pts)
+		if err != nil {
+			log.Printf("ERR: %v", err)
+			return
+		}
+
+		checkSize()
+	})
+
+	for _, audio := range audios {
+		_, err = client.Setup(desc.BaseURL, audio.media, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudio(client, muxer, audio, checkSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = client.Play(nil)
+	if err != nil {
+		return err
+	}
+	stream.RecordingPath = path
+
+	clientErr := make(chan error, 1)
+	go func() {
+		clientErr <- client.Wait()
+	}()
+
+	// A zero duration means that the recording is only bounded by its size.
+	var elapsed <-chan time.Time
+	if s.recordingDuration > 0 {
+		timer := time.NewTimer(s.recordingDuration)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	select {
+	case <-elapsed:
+	case <-full:
+	case <-ctx.Done():
+	case err = <-clientErr:
+		return err
+	}
+
+	if s.debug {
+		fmt.Printf("Recorded %s into %s\n", streamHost(*stream), path)
+	}
+	return nil
+}
+
+// recordingMuxer writes the access units of a stream into a recording file.
+// Video timestamps are expressed in the 90kHz clock of the video formats,
+// and audio timestamps in the clock rate of their format.
+type recordingMuxer interface {
+	// addAudioTrack adds a track for the audio format and returns its index,
+	// or false if the container cannot carry the format without transcoding.
+	// It needs to be called before initialize.
+	addAudioTrack(forma format.Format) (int, bool)
+	initialize() error
+	writeVideo(au [][]byte, pts int64) error
+	writeMPEG4Audio(track int, aus [][]byte, pts int64) error
+	writeOpus(track int, packet []byte, pts int64) error
+	size() int64
+	close()
+}
+
+// Recording formats.
+const (
+	recordingFormatMPEGTS = "ts"
+	recordingFormatFMP4   = "mp4"
+)
+
+// parseRecordingFormat returns the recording format matching the given
+// name or file extension.
+func parseRecordingFormat(name string) (string, error) {
+	switch strings.TrimPrefix(strings.ToLower(name), ".") {
+	case "", "ts", "mpegts":
+		return recordingFormatMPEGTS, nil
+	case "mp4", "fmp4":
+		return recordingFormatFMP4, nil
+	default:
+		return "", fmt.Errorf("unsupported recording format %q", name)
+	}
+}
+
+// newRecordingMuxer returns a muxer for the recording format, that records
+// the given H264 or H265 video format into the file.
+func newRecordingMuxer(recordingFormat, fileName string, video format.Format) recordingMuxer {
+	var h265 bool
+	var vps, sps, pps []byte
+	switch video := video.(type) {
+	case *format.H264:
+		sps, pps = video.SPS, video.PPS
+	case *format.H265:
+		h265 = true
+		vps, sps, pps = video.VPS, video.SPS, video.PPS
+	}
+
+	if recordingFormat == recordingFormatFMP4 {
+		return &fmp4Muxer{fileName: fileName, h265: h265, vps: vps, sps: sps, pps: pps}
+	}
+	return &mpegtsMuxer{fileName: fileName, h265: h265, vps: vps, sps: sps, pps: pps}
+}
+
+// recordedAudio is an audio media that is recorded along with the video.
+type recordedAudio struct {
+	media  *description.Media
+	format format.Format
+	track  int
+}
+
+// recordAudio writes the packets of the audio media into the muxer.
+func recordAudio(client *gortsplib.Client, muxer recordingMuxer, audio recordedAudio, written func()) error {
+	switch forma := audio.format.(type) {
+	case *format.MPEG4Audio:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return err
+		}
+
+		client.OnPacketRTP(audio.media, forma, func(pkt *rtp.Packet) {
+			pts, ok := client.PacketPTS(audio.media, pkt)
+			if !ok {
+				return
+			}
+
+			aus, err := rtpDec.Decode(pkt)
+			if err != nil {
+				if !isIncompleteFrame(err) {
+					log.Printf("ERR: %v", err)
+				}
+				return
+			}
+
+			err = muxer.writeMPEG4Audio(audio.track, aus, pts)
+			if err != nil {
+				log.Printf("ERR: %v", err)
+				return
+			}
+
+			written()
+		})
+
+	case *format.Opus:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return err
+		}
+
+		client.OnPacketRTP(audio.media, forma, func(pkt *rtp.Packet) {
+			pts, ok := client.PacketPTS(audio.media, pkt)
+			if !ok {
+				return
+			}
+
+			packet, err := rtpDec.Decode(pkt)
+			if err != nil {
+				log.Printf("ERR: %v", err)
+				return
+			}
+
+			err = muxer.writeOpus(audio.track, packet, pts)
+			if err != nil {
+				log.Printf("ERR: %v", err)
+				return
+			}
+
+			written()
+		})
+	}
+
+	return nil
+}
+
+// multiplyAndDivide computes v * m / d without overflowing.
+func multiplyAndDivide(v, m, d int64) int64 {
+	secs := v / d
+	dec := v % d
+	return secs*m + dec*m/d
+}
+
+// findRecordingFormat returns the first video format that can be recorded.
+func findRecordingFormat(desc *description.Session) (*description.Media, format.Format) {
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			switch forma.(type) {
+			case *format.H264, *format.H265:
+				return medi, forma
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,268 @@
+package cameradar
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ReportWriter writes the results of a scan in a report format.
+type ReportWriter interface {
+	WriteReport(w io.Writer, streams []Stream) error
+}
+
+// Report formats.
+const (
+	reportJSON     = "json"
+	reportCSV      = "csv"
+	reportMarkdown = "markdown"
+)
+
+// parseReportFormat returns the report format matching the name, which can
+// also be the extension of a file.
+func parseReportFormat(name string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "", reportJSON:
+		return reportJSON, nil
+	case reportCSV:
+		return reportCSV, nil
+	case reportMarkdown, "md":
+		return reportMarkdown, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q", name)
+	}
+}
+
+// ReportFormatFromPath returns the report format matching the extension of
+// the file, or an empty string, which stands for JSON, if none matches it.
+func ReportFormatFromPath(path string) string {
+	format, err := parseReportFormat(filepath.Ext(path))
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+// newReportWriter returns the report writer of the format.
+func newReportWriter(format string, schema int) ReportWriter {
+	switch format {
+	case reportCSV:
+		return csvReport{}
+	case reportMarkdown:
+		return markdownReport{}
+	default:
+		return jsonReport{schema: schema}
+	}
+}
+
+// jsonReport writes the streams as JSON, in a version of the output schema.
+type jsonReport struct {
+	schema int
+}
+
+func (r jsonReport) WriteReport(w io.Writer, streams []Stream) error {
+	jsonData, err := json.MarshalIndent(schemaResults(streams, r.schema), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling results: %w", err)
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		return fmt.Errorf("writing results to file: %w", err)
+	}
+	return nil
+}
+
+// csvReport writes a row for each route of each stream as CSV.
+type csvReport struct{}
+
+func (csvReport) WriteReport(w io.Writer, streams []Stream) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write(reportColumns)
+	if err != nil {
+		return fmt.Errorf("writing results to file: %w", err)
+	}
+
+	rows := reportRows(streams)
+	for _, row := range rows {
+		for i, value := range row {
+			row[i] = csvEscape(value)
+		}
+	}
+
+	err = writer.WriteAll(rows)
+	if err != nil {
+		return fmt.Errorf("writing results to file: %w", err)
+	}
+	return nil
+}
+
+// csvEscape prefixes the values that spreadsheets would read as formulas
+// with a quote, so that values sent by the scanned devices, such as their
+// server name, cannot run formulas when the report is opened.
+func csvEscape(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// markdownReport writes a row for each route of each stream
+// in a Markdown table.
+type markdownReport struct{}
+
+func (markdownReport) WriteReport(w io.Writer, streams []Stream) error {
+	var table strings.Builder
+	writeRow := func(row []string) {
+		table.WriteString("|")
+		for _, value := range row {
+			table.WriteString(" " + markdownEscaper.Replace(value) + " |")
+		}
+		table.WriteString("\n")
+	}
+
+	writeRow(reportColumns)
+	table.WriteString(strings.Repeat("| --- ", len(reportColumns)) + "|\n")
+	for _, row := range reportRows(streams) {
+		writeRow(row)
+	}
+
+	_, err := io.WriteString(w, table.String())
+	if err != nil {
+		return fmt.Errorf("writing results to file: %w", err)
+	}
+	return nil
+}
+
+// markdownEscaper escapes the values of Markdown table cells, which
+// cannot hold pipes or line breaks.
+var markdownEscaper = strings.NewReplacer(`|`, `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// reportColumns are the columns of the tabular reports,
+// named after the fields of the JSON output.
+var reportColumns = []string{
+	"device",
+	"address",
+	"port",
+	"route",
+	"route_behavior",
+	"server",
+	"available",
+	"credentials_found",
+	"username",
+	"password",
+	"authentication_type",
+	"validation_codec",
+	"first_frame_delay",
+	"snapshot_path",
+	"recording_path",
+	"skipped_tracks",
+	"lockout_state",
+	"lockout_reason",
+}
+
+// reportRows returns a row for each route of each stream, holding the
+// values of the report columns. The recording of a stream is the one of
+// its first route.
+func reportRows(streams []Stream) [][]string {
+	var rows [][]string
+	for _, stream := range streams {
+		stream.syncRouteResults()
+		for i, result := range stream.RouteResults {
+			routeStream := stream.forRoute(result)
+
+			var firstFrameDelay, recordingPath, skippedTracks string
+			if result.Available {
+				firstFrameDelay = result.FirstFrameDelay.String()
+			}
+			if i == 0 {
+				recordingPath = stream.RecordingPath
+				skippedTracks = strings.Join(stream.SkippedTracks, " ")
+			}
+
+			rows = append(rows, []string{
+				stream.Device,
+				stream.Address,
+				strconv.Itoa(int(stream.Port)),
+				result.Route,
+				stream.RouteBehavior,
+				stream.ServerInfo.Server,
+				strconv.FormatBool(result.Available),
+				strconv.FormatBool(routeStream.CredentialsFound),
+				routeStream.Username,
+				routeStream.Password,
+				routeStream.AuthenticationType,
+				result.ValidationCodec,
+				firstFrameDelay,
+				result.SnapshotPath,
+				recordingPath,
+				skippedTracks,
+				stream.LockoutState,
+				stream.LockoutReason,
+			})
+		}
+	}
+	return rows
+}
+
+// Credentials redaction modes.
+const (
+	redactNone      = "none"
+	redactPasswords = "passwords"
+	redactAll       = "all"
+)
+
+// redactedValue replaces the credentials that are redacted.
+const redactedValue = "********"
+
+// parseRedaction returns the credentials redaction mode matching the name.
+func parseRedaction(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", redactNone:
+		return redactNone, nil
+	case redactPasswords:
+		return redactPasswords, nil
+	case redactAll:
+		return redactAll, nil
+	default:
+		return "", fmt.Errorf("unsupported redaction mode %q", name)
+	}
+}
+
+// redactStreams returns copies of the streams whose credentials are redacted.
+func redactStreams(streams []Stream, mode string) []Stream {
+	if mode == redactNone || mode == "" {
+		return streams
+	}
+
+	redacted := slices.Clone(streams)
+	for i := range redacted {
+		stream := &redacted[i]
+		redactCredentials(&stream.Username, &stream.Password, mode)
+
+		stream.RouteResults = slices.Clone(stream.RouteResults)
+		for j := range stream.RouteResults {
+			result := &stream.RouteResults[j]
+			redactCredentials(&result.Username, &result.Password, mode)
+		}
+	}
+	return redacted
+}
+
+// redactCredentials redacts the password, and the username as well if every
+// credential is redacted. Empty credentials are kept as they are, since they
+// tell that the stream does not need them rather than what they are.
+func redactCredentials(username, password *string, mode string) {
+	if *password != "" {
+		*password = redactedValue
+	}
+	if mode == redactAll && *username != "" {
+		*username = redactedValue
+	}
+}
@@ -0,0 +1,151 @@
+package cameradar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRedactStreams(t *testing.T) {
+	streams := []Stream{
+		{
+			Address:  "192.168.1.10",
+			Username: "admin",
+			Password: "12345",
+			RouteResults: []RouteResult{
+				{Route: "ch1", Username: "admin", Password: "12345"},
+				{Route: "ch2", Username: "viewer", Password: ""},
+			},
+		},
+		{Address: "192.168.1.11"},
+	}
+
+	tests := []struct {
+		mode string
+		// want are the usernames and passwords of the first
+		// stream, followed by the ones of its routes.
+		want []string
+	}{
+		{mode: redactNone, want: []string{"admin", "12345", "admin", "12345", "viewer", ""}},
+		{mode: redactPasswords, want: []string{"admin", redactedValue, "admin", redactedValue, "viewer", ""}},
+		{mode: redactAll, want: []string{redactedValue, redactedValue, redactedValue, redactedValue, redactedValue, ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			redacted := redactStreams(streams, test.mode)
+
+			stream := redacted[0]
+			got := []string{stream.Username, stream.Password}
+			for _, result := range stream.RouteResults {
+				got = append(got, result.Username, result.Password)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("redactStreams() credentials = %q, want %q", got, test.want)
+			}
+			if redacted[1].Username != "" || redacted[1].Password != "" {
+				t.Errorf("redactStreams() filled empty credentials: %q, %q", redacted[1].Username, redacted[1].Password)
+			}
+
+			// The streams themselves are not redacted.
+			if streams[0].Password != "12345" || streams[0].RouteResults[0].Password != "12345" {
+				t.Error("redactStreams() modified the streams")
+			}
+		})
+	}
+}
+
+func TestCSVEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{value: "+1", want: "'+1"},
+		{value: "-1", want: "'-1"},
+		{value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{value: "\tcmd", want: "'\tcmd"},
+		{value: "\rcmd", want: "'\rcmd"},
+		{value: "Hikvision-Webs", want: "Hikvision-Webs"},
+		{value: "554", want: "554"},
+		{value: "", want: ""},
+	}
+	for _, test := range tests {
+		if got := csvEscape(test.value); got != test.want {
+			t.Errorf("csvEscape(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCSVReport(t *testing.T) {
+	streams := []Stream{{
+		Address:          "192.168.1.10",
+		Port:             554,
+		Routes:           []string{"-live"},
+		CredentialsFound: true,
+		Username:         "@admin",
+		Password:         "=1+1",
+		ServerInfo:       ServerInfo{Server: "=cmd|' /C calc'!A0"},
+		LockoutReason:    "+503 Service Unavailable",
+	}}
+
+	var out bytes.Buffer
+	err := csvReport{}.WriteReport(&out, streams)
+	if err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("report is not CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("report has %d records, want a header and a row", len(records))
+	}
+	if !slices.Equal(records[0], reportColumns) {
+		t.Errorf("report header = %q, want %q", records[0], reportColumns)
+	}
+
+	row := make(map[string]string)
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+	want := map[string]string{
+		"address":        "192.168.1.10",
+		"port":           "554",
+		"route":          "'-live",
+		"server":         "'=cmd|' /C calc'!A0",
+		"username":       "'@admin",
+		"password":       "'=1+1",
+		"lockout_reason": "'+503 Service Unavailable",
+	}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("report %s = %q, want %q", column, row[column], value)
+		}
+	}
+}
+
+func TestMarkdownReport(t *testing.T) {
+	streams := []Stream{{
+		Address:    "192.168.1.10",
+		Port:       554,
+		Routes:     []string{"live|main"},
+		ServerInfo: ServerInfo{Server: "cam\r\nserver"},
+	}}
+
+	var out bytes.Buffer
+	err := markdownReport{}.WriteReport(&out, streams)
+	if err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("report has %d lines, want a header, a separator and a row:\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[2], `| live\|main |`) || !strings.Contains(lines[2], "| cam server |") {
+		t.Errorf("report row %q does not escape pipes and line breaks", lines[2])
+	}
+}
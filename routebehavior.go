@@ -0,0 +1,108 @@
+package cameradar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+)
+
+// Route behaviors, which tell how a server answers requests for routes that
+// do not exist, and thus how its routes can be found.
+const (
+	// routeStrict servers answer that routes which do not exist are not
+	// found, so routes can be bruteforced without credentials.
+	routeStrict = "strict"
+	// routeAcceptsAny servers stream on any route, so there is
+	// no route to find.
+	routeAcceptsAny = "accepts_any_route"
+	// routeAuthFirst servers ask for credentials before checking the route,
+	// as GStreamer's RTSP server does, so routes can only be told apart once
+	// the credentials are found.
+	routeAuthFirst = "auth_before_route"
+)
+
+// dummyRouteProbes is the amount of random routes that
+// are requested to detect the route behavior of a server.
+const dummyRouteProbes = 2
+
+// DetectRouteBehaviors detects how the provided targets answer requests for
+// routes that do not exist, which decides how their routes are attacked.
+func (s *Scanner) DetectRouteBehaviors(targets []Stream) []Stream {
+	return s.DetectRouteBehaviorsContext(context.Background(), targets)
+}
+
+// DetectRouteBehaviorsContext is like DetectRouteBehaviors, but stops
+// detecting route behaviors when the context is canceled.
+func (s *Scanner) DetectRouteBehaviorsContext(ctx context.Context, targets []Stream) []Stream {
+	for i := range targets {
+		targets[i].RouteBehavior = s.detectRouteBehavior(ctx, targets[i])
+
+		if s.debug {
+			fmt.Printf("Stream %s has the %s route behavior\n", streamHost(targets[i]), targets[i].RouteBehavior)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return targets
+}
+
+// detectRouteBehavior requests random routes that cannot exist, and
+// classifies the server by its answers. Servers that cannot be probed are
+// considered strict, so that their routes are bruteforced.
+func (s *Scanner) detectRouteBehavior(ctx context.Context, stream Stream) string {
+	conn, err := dialRTSP(ctx, stream, s.timeout)
+	if err != nil {
+		return routeStrict
+	}
+	defer conn.close()
+
+	var statuses []base.StatusCode
+	for range dummyRouteProbes {
+		rawURL := fmt.Sprintf("rtsp://%s/%s", streamHost(stream), dummyRoute())
+		dummyURL, err := base.ParseURL(rawURL)
+		if err != nil {
+			return routeStrict
+		}
+
+		res, err := conn.describe(dummyURL, nil)
+		if err != nil {
+			return routeStrict
+		}
+		statuses = append(statuses, res.StatusCode)
+	}
+
+	behavior := ""
+	for _, status := range statuses {
+		var statusBehavior string
+		switch status {
+		case base.StatusOK:
+			statusBehavior = routeAcceptsAny
+		case base.StatusUnauthorized, base.StatusForbidden:
+			statusBehavior = routeAuthFirst
+		default:
+			return routeStrict
+		}
+
+		// Servers which do not answer every random route the same way
+		// are not trusted to tell routes apart either way.
+		if behavior != "" && behavior != statusBehavior {
+			return routeStrict
+		}
+		behavior = statusBehavior
+	}
+
+	return behavior
+}
+
+// dummyRoute returns a random route that should never be a constructor default.
+func dummyRoute() string {
+	b := make([]byte, 8)
+	rand.Read(b) //nolint:errcheck
+	return hex.EncodeToString(b)
+}
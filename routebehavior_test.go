@@ -0,0 +1,136 @@
+package cameradar
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestDetectRouteBehavior(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses are the status codes of the answers to the requests,
+		// where 0 closes the connection without answering.
+		statuses []int
+		want     string
+	}{
+		{name: "every route exists", statuses: []int{200, 200}, want: routeAcceptsAny},
+		{name: "unauthorized", statuses: []int{401, 401}, want: routeAuthFirst},
+		{name: "forbidden", statuses: []int{403, 403}, want: routeAuthFirst},
+		{name: "unauthorized then forbidden", statuses: []int{401, 403}, want: routeAuthFirst},
+		{name: "not found", statuses: []int{404, 404}, want: routeStrict},
+		{name: "bad request", statuses: []int{400, 400}, want: routeStrict},
+		{name: "found then unauthorized", statuses: []int{200, 401}, want: routeStrict},
+		{name: "unauthorized then not found", statuses: []int{401, 404}, want: routeStrict},
+		{name: "closed connection", statuses: []int{0}, want: routeStrict},
+		{name: "closed after the first answer", statuses: []int{200, 0}, want: routeStrict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var requests []string
+			server := startTestServer(t, func(req testRequest) testResponse {
+				mutex.Lock()
+				defer mutex.Unlock()
+				requests = append(requests, routePath(req.url))
+
+				status := test.statuses[len(requests)-1]
+				return testResponse{status: status, close: status == 0}
+			})
+
+			got := newTestScanner(1).detectRouteBehavior(context.Background(), server.stream())
+			if got != test.want {
+				t.Errorf("detectRouteBehavior() = %q, want %q", got, test.want)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(requests) == dummyRouteProbes && requests[0] == requests[1] {
+				t.Errorf("detectRouteBehavior() requested the same route twice: %q", requests[0])
+			}
+		})
+	}
+}
+
+func TestDetectRouteBehaviorUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	stream := Stream{Address: addr.IP.String(), Port: uint16(addr.Port)}
+	listener.Close()
+
+	got := newTestScanner(1).detectRouteBehavior(context.Background(), stream)
+	if got != routeStrict {
+		t.Errorf("detectRouteBehavior() = %q, want %q", got, routeStrict)
+	}
+}
+
+func TestAttackCameraRouteBehaviors(t *testing.T) {
+	routes := Routes{"live", "stream"}
+
+	tests := []struct {
+		behavior         string
+		credentialsFound bool
+		wantRoutes       []string
+		wantRouteFound   bool
+		wantRequests     bool
+	}{
+		// Strict servers have their routes bruteforced.
+		{behavior: routeStrict, wantRoutes: []string{"live"}, wantRouteFound: true, wantRequests: true},
+		// Servers accepting any route are streamed from the empty route.
+		{behavior: routeAcceptsAny, wantRoutes: []string{""}, wantRouteFound: true},
+		// Servers authenticating first wait for their credentials.
+		{behavior: routeAuthFirst},
+		{behavior: routeAuthFirst, credentialsFound: true, wantRoutes: []string{"live"}, wantRouteFound: true, wantRequests: true},
+	}
+	for _, test := range tests {
+		t.Run(test.behavior, func(t *testing.T) {
+			var mutex sync.Mutex
+			var requests int
+			server := startTestServer(t, func(req testRequest) testResponse {
+				mutex.Lock()
+				requests++
+				mutex.Unlock()
+
+				switch {
+				case test.behavior == routeAuthFirst && req.header.Get("Authorization") != basicAuthorization("admin", "admin"):
+					return testResponse{status: 401, header: map[string]string{"WWW-Authenticate": `Basic realm="cam"`}}
+				case routePath(req.url) == "live":
+					return testResponse{status: 200}
+				}
+				return testResponse{status: 404}
+			})
+
+			scanner := newTestScanner(1)
+			scanner.routes = routes
+			scanner.routeDiscovery = routeDiscoveryAll
+
+			stream := server.stream()
+			stream.RouteBehavior = test.behavior
+			if test.credentialsFound {
+				stream.CredentialsFound = true
+				stream.Username = "admin"
+				stream.Password = "admin"
+				stream.AuthMethods = []AuthInfo{{Type: authBasic, Realm: "cam"}}
+			}
+
+			results := make(chan Stream, 1)
+			scanner.attackCameraRoute(context.Background(), stream, results)
+			got := <-results
+
+			if !slices.Equal(got.Routes, test.wantRoutes) || got.RouteFound != test.wantRouteFound {
+				t.Errorf("attackCameraRoute() routes = %q, found: %t, want %q, found: %t", got.Routes, got.RouteFound, test.wantRoutes, test.wantRouteFound)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if (requests > 0) != test.wantRequests {
+				t.Errorf("attackCameraRoute() sent %d requests, want requests: %t", requests, test.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package cameradar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Route discovery modes.
+const (
+	// routeDiscoveryFirst stops the route attack at the first route found.
+	routeDiscoveryFirst = "first"
+	// routeDiscoveryAll finds every route of the dictionary that exists,
+	// such as the main and sub streams of each channel.
+	routeDiscoveryAll = "all"
+	// routeDiscoveryPerChannel finds a route for each channel of the device,
+	// including the channels that the dictionary does not list routes for.
+	routeDiscoveryPerChannel = "per-channel"
+)
+
+// maxChannels is the amount of channels that
+// are looked for in the per-channel mode.
+const maxChannels = 16
+
+// parseRouteDiscovery returns the route discovery mode matching the name.
+func parseRouteDiscovery(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", routeDiscoveryAll:
+		return routeDiscoveryAll, nil
+	case routeDiscoveryFirst:
+		return routeDiscoveryFirst, nil
+	case routeDiscoveryPerChannel, "channel", "channels":
+		return routeDiscoveryPerChannel, nil
+	default:
+		return "", fmt.Errorf("unsupported route discovery mode %q", name)
+	}
+}
+
+// channelPattern matches the channel number of routes such as
+// cam/realmonitor?channel=1, Streaming/Channels/101 or h264/ch1/main/av_stream.
+var channelPattern = regexp.MustCompile(`(?i)(channel=|channels/|(?:^|/)ch)(\d+)`)
+
+// routeChannel returns the channel of the route, or false if the route
+// does not contain a channel number.
+func routeChannel(route string) (int, bool) {
+	match := channelPattern.FindStringSubmatch(route)
+	if match == nil {
+		return 0, false
+	}
+
+	channel, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, false
+	}
+
+	// Hikvision routes hold the channel followed by the two digits of the
+	// stream type, such as 101 and 102 for the main and sub streams of the
+	// first channel.
+	if strings.EqualFold(match[1], "channels/") && len(match[2]) >= 3 {
+		channel /= 100
+	}
+	return channel, true
+}
+
+// withChannel returns the route with its channel number replaced.
+func withChannel(route string, channel int) string {
+	return channelPattern.ReplaceAllStringFunc(route, func(s string) string {
+		match := channelPattern.FindStringSubmatch(s)
+		if strings.EqualFold(match[1], "channels/") && len(match[2]) >= 3 {
+			return match[1] + strconv.Itoa(channel) + match[2][len(match[2])-2:]
+		}
+		return match[1] + strconv.Itoa(channel)
+	})
+}
+
+// firstRoutePerChannel keeps the first of the routes of each channel, and
+// the first of the routes which do not contain a channel number.
+func firstRoutePerChannel(routes []string) []string {
+	var kept []string
+	seen := make(map[int]bool)
+	seenNoChannel := false
+	for _, route := range routes {
+		channel, ok := routeChannel(route)
+		switch {
+		case !ok && !seenNoChannel:
+			seenNoChannel = true
+			kept = append(kept, route)
+		case ok && !seen[channel]:
+			seen[channel] = true
+			kept = append(kept, route)
+		}
+	}
+	return kept
+}
+
+// channelRoutes returns the routes of the other channels of the device,
+// based on the first route found that contains a channel number.
+func channelRoutes(found []string) Routes {
+	var template string
+	channels := make(map[int]bool)
+	for _, route := range found {
+		channel, ok := routeChannel(route)
+		if !ok {
+			continue
+		}
+		if template == "" {
+			template = route
+		}
+		channels[channel] = true
+	}
+	if template == "" {
+		return nil
+	}
+
+	var routes Routes
+	for channel := 1; channel <= maxChannels; channel++ {
+		if !channels[channel] {
+			routes = append(routes, withChannel(template, channel))
+		}
+	}
+	return routes
+}
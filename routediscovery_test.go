@@ -0,0 +1,178 @@
+package cameradar
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestRouteChannel(t *testing.T) {
+	tests := []struct {
+		route       string
+		wantChannel int
+		wantOK      bool
+	}{
+		{route: "cam/realmonitor?channel=1&subtype=0", wantChannel: 1, wantOK: true},
+		{route: "cam/realmonitor?Channel=12&subtype=1", wantChannel: 12, wantOK: true},
+		{route: "Streaming/Channels/101", wantChannel: 1, wantOK: true},
+		{route: "Streaming/Channels/1602", wantChannel: 16, wantOK: true},
+		{route: "Streaming/Channels/2", wantChannel: 2, wantOK: true},
+		{route: "h264/ch3/main/av_stream", wantChannel: 3, wantOK: true},
+		{route: "ch4/0", wantChannel: 4, wantOK: true},
+		{route: "live.sdp"},
+		{route: "archive/chapter"},
+		{route: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.route, func(t *testing.T) {
+			channel, ok := routeChannel(test.route)
+			if channel != test.wantChannel || ok != test.wantOK {
+				t.Errorf("routeChannel(%q) = %d, %t, want %d, %t", test.route, channel, ok, test.wantChannel, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestWithChannel(t *testing.T) {
+	tests := []struct {
+		route   string
+		channel int
+		want    string
+	}{
+		{route: "cam/realmonitor?channel=1&subtype=0", channel: 5, want: "cam/realmonitor?channel=5&subtype=0"},
+		{route: "Streaming/Channels/101", channel: 2, want: "Streaming/Channels/201"},
+		{route: "Streaming/Channels/102", channel: 12, want: "Streaming/Channels/1202"},
+		{route: "Streaming/Channels/1", channel: 3, want: "Streaming/Channels/3"},
+		{route: "h264/ch1/main/av_stream", channel: 4, want: "h264/ch4/main/av_stream"},
+		{route: "live.sdp", channel: 2, want: "live.sdp"},
+	}
+	for _, test := range tests {
+		t.Run(test.route, func(t *testing.T) {
+			got := withChannel(test.route, test.channel)
+			if got != test.want {
+				t.Errorf("withChannel(%q, %d) = %q, want %q", test.route, test.channel, got, test.want)
+			}
+
+			if channel, ok := routeChannel(test.route); ok {
+				channel, _ = routeChannel(got)
+				if channel != test.channel {
+					t.Errorf("routeChannel(%q) = %d, want %d", got, channel, test.channel)
+				}
+			}
+		})
+	}
+}
+
+func TestFirstRoutePerChannel(t *testing.T) {
+	routes := []string{
+		"Streaming/Channels/101",
+		"Streaming/Channels/102",
+		"live.sdp",
+		"Streaming/Channels/201",
+		"h264/ch1/main/av_stream",
+		"media.amp",
+	}
+	want := []string{"Streaming/Channels/101", "live.sdp", "Streaming/Channels/201"}
+
+	got := firstRoutePerChannel(routes)
+	if !slices.Equal(got, want) {
+		t.Errorf("firstRoutePerChannel() = %q, want %q", got, want)
+	}
+}
+
+func TestChannelRoutes(t *testing.T) {
+	tests := []struct {
+		name  string
+		found []string
+		want  Routes
+	}{
+		{
+			name:  "no channel",
+			found: []string{"live.sdp"},
+		},
+		{
+			name:  "other channels of the first route with a channel",
+			found: []string{"live.sdp", "cam/realmonitor?channel=2&subtype=0", "h264/ch1/main/av_stream"},
+			want: Routes{
+				"cam/realmonitor?channel=3&subtype=0", "cam/realmonitor?channel=4&subtype=0",
+				"cam/realmonitor?channel=5&subtype=0", "cam/realmonitor?channel=6&subtype=0",
+				"cam/realmonitor?channel=7&subtype=0", "cam/realmonitor?channel=8&subtype=0",
+				"cam/realmonitor?channel=9&subtype=0", "cam/realmonitor?channel=10&subtype=0",
+				"cam/realmonitor?channel=11&subtype=0", "cam/realmonitor?channel=12&subtype=0",
+				"cam/realmonitor?channel=13&subtype=0", "cam/realmonitor?channel=14&subtype=0",
+				"cam/realmonitor?channel=15&subtype=0", "cam/realmonitor?channel=16&subtype=0",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := channelRoutes(test.found)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("channelRoutes() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttackCameraRoutePerChannel(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     []string
+		// wantRequests is the amount of routes tried.
+		wantRequests int
+	}{
+		{
+			name:         "routes without channel",
+			existing:     []string{"live.sdp"},
+			want:         []string{"live.sdp"},
+			wantRequests: 3,
+		},
+		{
+			name:         "other channels",
+			existing:     []string{"ch1/main", "ch1/sub", "ch3/main"},
+			want:         []string{"ch1/main", "ch3/main"},
+			wantRequests: 3 + maxChannels - 1,
+		},
+		{
+			name:         "no route",
+			wantRequests: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var requests int
+			server := startTestServer(t, func(req testRequest) testResponse {
+				mutex.Lock()
+				requests++
+				mutex.Unlock()
+				if slices.Contains(test.existing, routePath(req.url)) {
+					return testResponse{status: 200}
+				}
+				return testResponse{status: 404}
+			})
+
+			scanner := newTestScanner(2)
+			scanner.routeDiscovery = routeDiscoveryPerChannel
+			scanner.routes = Routes{"live.sdp", "ch1/main", "ch1/sub"}
+
+			stream := server.stream()
+			stream.RouteBehavior = routeStrict
+			results := make(chan Stream, 1)
+			scanner.attackCameraRoute(context.Background(), stream, results)
+			got := <-results
+
+			if !slices.Equal(got.Routes, test.want) || got.RouteFound != (len(test.want) > 0) {
+				t.Errorf("attackCameraRoute() routes = %q, found: %t, want %q", got.Routes, got.RouteFound, test.want)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if requests != test.wantRequests {
+				t.Errorf("attackCameraRoute() tried %d routes, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/sdp"
+)
+
+// defaultRTSPTimeout is the timeout of the requests sent through an
+// rtspConn when the scanner has none, which is the one of gortsplib.
+const defaultRTSPTimeout = 10 * time.Second
+
+// rtspConn is a raw RTSP connection to a stream. Unlike gortsplib's client,
+// it sends requests as they are, without negotiating the authentication,
+// and it can send requests before the responses to the previous ones are
+// received, so that many attempts can be made through a single connection.
+type rtspConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	timeout time.Duration
+	cseq    int
+	// pending are the CSeq of the requests whose response
+	// was not received yet, in the order they were sent.
+	pending []int
+	stop    func() bool
+}
+
+// dialRTSP opens a connection to the server of the stream, which gets closed
+// as soon as the context is canceled.
+func dialRTSP(ctx context.Context, stream Stream, timeout time.Duration) (*rtspConn, error) {
+	if timeout <= 0 {
+		timeout = defaultRTSPTimeout
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", streamHost(stream))
+	if err != nil {
+		return nil, err
+	}
+
+	return &rtspConn{
+		conn:    conn,
+		br:      bufio.NewReader(conn),
+		timeout: timeout,
+		stop:    context.AfterFunc(ctx, func() { conn.Close() }),
+	}, nil
+}
+
+// close closes the connection.
+func (c *rtspConn) close() {
+	c.stop()
+	c.conn.Close()
+}
+
+// describe sends a DESCRIBE request for the URL with the given
+// headers, and returns the response of the server.
+func (c *rtspConn) describe(u *base.URL, header base.Header) (*base.Response, error) {
+	err := c.send(base.Describe, u, header)
+	if err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// send sends a request for the URL with the given headers,
+// without waiting for its response.
+func (c *rtspConn) send(method base.Method, u *base.URL, header base.Header) error {
+	c.cseq++
+
+	req := base.Request{
+		Method: method,
+		URL:    u,
+		Header: base.Header{
+			"CSeq": base.HeaderValue{strconv.Itoa(c.cseq)},
+		},
+	}
+	if method == base.Describe {
+		req.Header["Accept"] = base.HeaderValue{"application/sdp"}
+	}
+	for key, value := range header {
+		req.Header[key] = value
+	}
+
+	byts, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout)) //nolint:errcheck
+	_, err = c.conn.Write(byts)
+	if err != nil {
+		return err
+	}
+
+	c.pending = append(c.pending, c.cseq)
+	return nil
+}
+
+// receive returns the response to the oldest request whose response was
+// not received yet. Servers answer requests in the order they were sent.
+func (c *rtspConn) receive() (*base.Response, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("no request is waiting for a response")
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout)) //nolint:errcheck
+
+	var res base.Response
+	err := res.Unmarshal(c.br)
+	if err != nil {
+		return nil, err
+	}
+
+	cseq := c.pending[0]
+	c.pending = c.pending[1:]
+
+	// Some servers do not send the CSeq back, but the ones which send
+	// another one are not answering the request that we expect.
+	if value, ok := res.Header["CSeq"]; ok && len(value) > 0 && strings.TrimSpace(value[0]) != strconv.Itoa(cseq) {
+		return nil, fmt.Errorf("received the response to request %s instead of %d", value[0], cseq)
+	}
+
+	return &res, nil
+}
+
+// parseSessionDescription returns the session described by the response to
+// a DESCRIBE request for the URL.
+func parseSessionDescription(u *base.URL, res *base.Response) (description.Session, error) {
+	var sd sdp.SessionDescription
+	err := sd.Unmarshal(res.Body)
+	if err != nil {
+		return description.Session{}, err
+	}
+
+	var desc description.Session
+	err = desc.Unmarshal(&sd)
+	if err != nil {
+		return description.Session{}, err
+	}
+
+	desc.BaseURL = u
+	if contentBase, ok := res.Header["Content-Base"]; ok && len(contentBase) > 0 {
+		baseURL, err := base.ParseURL(contentBase[0])
+		if err == nil {
+			desc.BaseURL = baseURL
+		}
+	}
+
+	return desc, nil
+}
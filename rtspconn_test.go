@@ -0,0 +1,379 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+)
+
+// testRequest is a request received by a testServer.
+type testRequest struct {
+	method string
+	url    string
+	header textproto.MIMEHeader
+	// conn is the number of the connection through which
+	// the request was received, starting at 1.
+	conn int
+}
+
+// testResponse is the response of a testServer to a request. A response
+// without status code is not sent, and the connection is closed if close
+// is set, after the response is sent if there is one.
+type testResponse struct {
+	status int
+	header map[string]string
+	body   string
+	close  bool
+}
+
+// testServer is an RTSP server listening on the loopback interface, which
+// answers each request it receives with the response returned by handle.
+// Requests are answered in the order they are received on each connection,
+// so that they can be pipelined.
+type testServer struct {
+	addr   string
+	handle func(req testRequest) testResponse
+	conns  atomic.Int64
+	wg     sync.WaitGroup
+
+	mutex    sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// startTestServer starts a test server, which is closed at the end of the test.
+func startTestServer(tb testing.TB, handle func(req testRequest) testResponse) *testServer {
+	tb.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("unable to listen: %v", err)
+	}
+
+	server := &testServer{addr: listener.Addr().String(), handle: handle, listener: listener}
+	server.wg.Add(1)
+	go server.serve(listener)
+	tb.Cleanup(func() {
+		server.mutex.Lock()
+		server.closed = true
+		server.listener.Close()
+		server.mutex.Unlock()
+		server.wg.Wait()
+	})
+	return server
+}
+
+// stream returns the stream served by the server.
+func (s *testServer) stream() Stream {
+	host, port, _ := net.SplitHostPort(s.addr)
+	portNumber, _ := strconv.Atoi(port)
+	return Stream{Address: host, Port: uint16(portNumber)}
+}
+
+// pause stops accepting connections, so that they are refused, until the
+// duration elapsed. Open connections are still answered.
+func (s *testServer) pause(d time.Duration) {
+	s.mutex.Lock()
+	s.listener.Close()
+	s.wg.Add(1)
+	s.mutex.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		time.Sleep(d)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.closed {
+			return
+		}
+		listener, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return
+		}
+		s.listener = listener
+		s.wg.Add(1)
+		go s.serve(listener)
+	}()
+}
+
+func (s *testServer) serve(listener net.Listener) {
+	defer s.wg.Done()
+
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		id := int(s.conns.Add(1))
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			defer conn.Close()
+			s.serveConn(conn, id)
+		}()
+	}
+}
+
+func (s *testServer) serveConn(conn net.Conn, id int) {
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+
+		method, rest, _ := strings.Cut(line, " ")
+		url, _, _ := strings.Cut(rest, " ")
+		res := s.handle(testRequest{method: method, url: url, header: header, conn: id})
+
+		if res.status != 0 {
+			var raw strings.Builder
+			fmt.Fprintf(&raw, "RTSP/1.0 %d Status\r\nCSeq: %s\r\n", res.status, header.Get("CSeq"))
+			for key, value := range res.header {
+				fmt.Fprintf(&raw, "%s: %s\r\n", key, value)
+			}
+			if res.body != "" {
+				fmt.Fprintf(&raw, "Content-Length: %d\r\n", len(res.body))
+			}
+			raw.WriteString("\r\n" + res.body)
+
+			_, err = conn.Write([]byte(raw.String()))
+			if err != nil {
+				return
+			}
+		}
+		if res.close {
+			return
+		}
+	}
+}
+
+// newTestScanner returns a scanner with the given amount of workers per host,
+// which only sets what attacks need.
+func newTestScanner(concurrency int) *Scanner {
+	return &Scanner{
+		hostConcurrency:   concurrency,
+		globalConcurrency: concurrency,
+		timeout:           time.Second,
+		lockoutBackoff:    time.Millisecond,
+		scheduler:         newAttackScheduler(concurrency, concurrency, 0),
+	}
+}
+
+// routePath returns the route of the URL of a request.
+func routePath(rawURL string) string {
+	_, path, _ := strings.Cut(strings.TrimPrefix(rawURL, "rtsp://"), "/")
+	return path
+}
+
+func TestRTSPConnPipelinesRequests(t *testing.T) {
+	server := startTestServer(t, func(req testRequest) testResponse {
+		if routePath(req.url) == "live" {
+			return testResponse{status: 200}
+		}
+		return testResponse{status: 404}
+	})
+	stream := server.stream()
+
+	conn, err := dialRTSP(context.Background(), stream, time.Second)
+	if err != nil {
+		t.Fatalf("dialRTSP() error = %v", err)
+	}
+	defer conn.close()
+
+	routes := []string{"missing", "live", "other"}
+	for _, route := range routes {
+		u, err := base.ParseURL(fmt.Sprintf("rtsp://%s/%s", streamHost(stream), route))
+		if err != nil {
+			t.Fatalf("ParseURL() error = %v", err)
+		}
+		err = conn.send(base.Describe, u, nil)
+		if err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+
+	want := []base.StatusCode{base.StatusNotFound, base.StatusOK, base.StatusNotFound}
+	for i, status := range want {
+		res, err := conn.receive()
+		if err != nil {
+			t.Fatalf("receive() of %q error = %v", routes[i], err)
+		}
+		if res.StatusCode != status {
+			t.Errorf("receive() of %q status = %d, want %d", routes[i], res.StatusCode, status)
+		}
+	}
+
+	_, err = conn.receive()
+	if err == nil {
+		t.Error("receive() without pending request succeeded")
+	}
+}
+
+func TestRTSPConnRejectsResponseToAnotherRequest(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := textproto.NewReader(bufio.NewReader(conn))
+		_, _ = reader.ReadLine()
+		_, _ = reader.ReadMIMEHeader()
+		_, _ = conn.Write([]byte("RTSP/1.0 200 OK\r\nCSeq: 42\r\n\r\n"))
+		_, _ = reader.ReadLine()
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	stream := Stream{Address: addr.IP.String(), Port: uint16(addr.Port)}
+	conn, err := dialRTSP(context.Background(), stream, time.Second)
+	if err != nil {
+		t.Fatalf("dialRTSP() error = %v", err)
+	}
+	defer conn.close()
+
+	u, _ := base.ParseURL(fmt.Sprintf("rtsp://%s/live", streamHost(stream)))
+	_, err = conn.describe(u, nil)
+	if err == nil {
+		t.Error("describe() accepted the response to another request")
+	}
+}
+
+func TestRouteAttack(t *testing.T) {
+	routes := Routes{"a", "b", "live", "c", "d", "e", "stream", "f", "g", "h"}
+	want := []string{"live", "stream"}
+
+	tests := []struct {
+		name string
+		// closeEvery closes each connection after
+		// answering that many requests, if set.
+		closeEvery int
+	}{
+		{name: "pipelined"},
+		{name: "server closing connections", closeEvery: 3},
+		{name: "server answering one request per connection", closeEvery: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			answered := make(map[int]int)
+			server := startTestServer(t, func(req testRequest) testResponse {
+				mutex.Lock()
+				answered[req.conn]++
+				closing := test.closeEvery > 0 && answered[req.conn] >= test.closeEvery
+				mutex.Unlock()
+
+				res := testResponse{status: 404, close: closing}
+				if slices.Contains(want, routePath(req.url)) {
+					res.status = 401
+				}
+				return res
+			})
+
+			scanner := newTestScanner(2)
+			got := scanner.routeAttack(context.Background(), server.stream(), routes, false)
+			if !slices.Equal(got, want) {
+				t.Errorf("routeAttack() = %q, want %q", got, want)
+			}
+
+			first := scanner.routeAttack(context.Background(), server.stream(), routes, true)
+			if !slices.Equal(first, want[:1]) {
+				t.Errorf("routeAttack() of the first route = %q, want %q", first, want[:1])
+			}
+		})
+	}
+}
+
+func TestRouteAttackRedialsAfterConnectionFailure(t *testing.T) {
+	// The server closes its first connection after answering its first
+	// request, and refuses connections for a moment after it, so the worker
+	// fails to open its connection again at first.
+	var server *testServer
+	var requests atomic.Int64
+	server = startTestServer(t, func(req testRequest) testResponse {
+		if req.conn == 1 && requests.Add(1) == 2 {
+			server.pause(routeRedialBackoff / 2)
+			return testResponse{close: true}
+		}
+		if routePath(req.url) == "live" {
+			return testResponse{status: 200}
+		}
+		return testResponse{status: 404}
+	})
+	stream := server.stream()
+
+	got := newTestScanner(1).routeAttack(context.Background(), stream, Routes{"a", "live", "b"}, false)
+	if !slices.Equal(got, []string{"live"}) {
+		t.Errorf("routeAttack() = %q, want %q", got, []string{"live"})
+	}
+}
+
+// BenchmarkRouteAttack compares the route attack, which pipelines its
+// requests through a connection, with sending each request through its own
+// connection and waiting for its response.
+func BenchmarkRouteAttack(b *testing.B) {
+	server := startTestServer(b, func(req testRequest) testResponse {
+		return testResponse{status: 404}
+	})
+	stream := server.stream()
+
+	routes := make(Routes, 256)
+	for i := range routes {
+		routes[i] = fmt.Sprintf("route%d", i)
+	}
+
+	b.Run("pipelined", func(b *testing.B) {
+		scanner := newTestScanner(1)
+		for b.Loop() {
+			scanner.routeAttack(context.Background(), stream, routes, false)
+		}
+	})
+
+	b.Run("per-route", func(b *testing.B) {
+		urls := make([]*base.URL, len(routes))
+		for i, route := range routes {
+			urls[i], _ = base.ParseURL(fmt.Sprintf("rtsp://%s/%s", streamHost(stream), route))
+		}
+
+		for b.Loop() {
+			for _, u := range urls {
+				conn, err := dialRTSP(context.Background(), stream, time.Second)
+				if err != nil {
+					b.Fatalf("dialRTSP() error = %v", err)
+				}
+				_, err = conn.describe(u, nil)
+				conn.close()
+				if err != nil {
+					b.Fatalf("describe() error = %v", err)
+				}
+			}
+		}
+	})
+}
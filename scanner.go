@@ -1,18 +1,47 @@
 package cameradar
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
 )
 
 const (
-	defaultCredentialDictionaryPath = "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/credentials.json"
-	defaultRouteDictionaryPath      = "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/routes"
+	defaultValidationWindow = 10 * time.Second
+	defaultValidationFrames = 10
+
+	defaultRecordingDuration = 30 * time.Second
+
+	defaultHostConcurrency   = 4
+	defaultGlobalConcurrency = 200
+
+	minScanSpeed     = 1
+	maxScanSpeed     = 5
+	defaultScanSpeed = 4
 )
 
+// scanSpeedWorkers maps each scan speed to the amount of ports
+// that are scanned concurrently.
+var scanSpeedWorkers = map[int]int{
+	1: 10,
+	2: 50,
+	3: 200,
+	4: 500,
+	5: 1000,
+}
+
 // Scanner represents a cameradar scanner. It scans a network and
 // attacks all streams found to get their RTSP credentials.
 type Scanner struct {
@@ -22,124 +51,343 @@ type Scanner struct {
 	verbose                  bool
 	scanSpeed                int
 	attackInterval           time.Duration
+	hostConcurrency          int
+	routeDiscovery           string
+	outputSchema             int
+	outputFormat             string
+	redaction                string
+	globalConcurrency        int
+	lockoutBackoff           time.Duration
 	timeout                  time.Duration
+	validationWindow         time.Duration
+	validationFrames         int
+	snapshotDir              string
+	recordingDir             string
+	recordingFormat          string
+	recordingDuration        time.Duration
+	recordingMaxSize         int64
 	credentialDictionaryPath string
 	routeDictionaryPath      string
+	extendDictionaries       bool
+	checkpointPath           string
+	resume                   bool
 
 	credentials Credentials
 	routes      Routes
+	scheduler   *attackScheduler
+	checkpoint  *checkpoint
+	events      *eventWriter
+	// reportWriter writes the results, in the output format
+	// unless a custom writer was specified.
+	reportWriter ReportWriter
 }
 
+// PortStatus is the result of the scan of a single port of a host.
 type PortStatus struct {
-	host     string
-	port     int
-	isOpened bool
-	isRTSP   bool
-	banner   string
+	host       string
+	port       int
+	isOpened   bool
+	isRTSP     bool
+	banner     string
+	serverInfo ServerInfo
 }
 
-func isPortRTSP(conn net.Conn) (bool, []byte, error) {
+// maxBannerSize is the maximum size of the response
+// to the OPTIONS request that is read during the scan.
+const maxBannerSize = 64 * 1024
+
+// isPortRTSP sends an OPTIONS request through the connection, and returns
+// whether the server answered with an RTSP response, along with the raw
+// response and the information it holds about the server.
+func isPortRTSP(conn net.Conn) (bool, string, ServerInfo, error) {
 	req := "OPTIONS * RTSP/1.0\r\nCSeq: 1\r\nContent-Length: 0\r\n\r\n"
-	buffer := make([]byte, 4)
-	fullbuffer := make([]byte, 256)
 	defer conn.Close()
 	_, err := conn.Write([]byte(req))
 	if err != nil {
-		return false, nil, err
+		return false, "", ServerInfo{}, err
 	}
-	_, err = conn.Read(fullbuffer)
+
+	var raw bytes.Buffer
+	br := bufio.NewReader(io.TeeReader(io.LimitReader(conn, maxBannerSize), &raw))
+
+	magic, err := br.Peek(4)
 	if err != nil {
-		return false, nil, err
+		return false, raw.String(), ServerInfo{}, err
 	}
-	if len(fullbuffer) >= 4 {
-		copy(buffer, fullbuffer[:4])
+	if string(magic) != "RTSP" {
+		return false, raw.String(), ServerInfo{}, nil
 	}
-	if string(buffer) == "RTSP" {
-		return true, fullbuffer, nil
+
+	var res base.Response
+	err = res.Unmarshal(br)
+	if err != nil {
+		// The server speaks RTSP, even though its response is malformed.
+		return true, raw.String(), ServerInfo{}, nil
 	}
-	return false, fullbuffer, nil
+
+	return true, raw.String(), newServerInfo(&res), nil
 }
 
-func isPortOpened(protocol, hostname string, port int, timeout time.Duration, wg *sync.WaitGroup, results chan<- PortStatus) {
-	defer wg.Done()
-	address := fmt.Sprintf("%s:%d", hostname, port)
-	conn, err := net.DialTimeout(protocol, address, timeout*time.Second)
+// newServerInfo extracts the information about the server from its response.
+func newServerInfo(res *base.Response) ServerInfo {
+	info := ServerInfo{
+		StatusCode:      int(res.StatusCode),
+		StatusMessage:   res.StatusMessage,
+		WWWAuthenticate: res.Header["WWW-Authenticate"],
+	}
+
+	if cseq, ok := res.Header["CSeq"]; ok && len(cseq) > 0 {
+		info.CSeq = cseq[0]
+	}
+	if server, ok := res.Header["Server"]; ok && len(server) > 0 {
+		info.Server = server[0]
+	}
+
+	for _, public := range res.Header["Public"] {
+		for _, method := range strings.Split(public, ",") {
+			method = strings.TrimSpace(method)
+			if method != "" {
+				info.Methods = append(info.Methods, method)
+			}
+		}
+	}
+
+	return info
+}
+
+func isPortOpened(ctx context.Context, protocol, hostname string, port int, timeout time.Duration) PortStatus {
+	if timeout <= 0 {
+		timeout = defaultRTSPTimeout
+	}
+
+	address := net.JoinHostPort(hostname, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, protocol, address)
 	if err != nil {
-		results <- PortStatus{host: hostname, port: port, isOpened: false, isRTSP: false, banner: ""}
-		return
+		return PortStatus{host: hostname, port: port, isOpened: false, isRTSP: false, banner: ""}
 	}
-	status, banner, err := isPortRTSP(conn)
+
+	// Make sure that a host which accepts the connection but never answers
+	// does not block the scan, and that the scan can be interrupted.
+	conn.SetDeadline(time.Now().Add(timeout)) //nolint:errcheck
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	status, banner, info, err := isPortRTSP(conn)
 	if err != nil {
-		results <- PortStatus{host: hostname, port: port, isOpened: true, isRTSP: false, banner: string(banner)}
-		return
+		return PortStatus{host: hostname, port: port, isOpened: true, isRTSP: false, banner: banner}
 	}
 	if status {
-		results <- PortStatus{host: hostname, port: port, isOpened: true, isRTSP: true, banner: string(banner)}
-		return
+		return PortStatus{host: hostname, port: port, isOpened: true, isRTSP: true, banner: banner, serverInfo: info}
 	}
-	results <- PortStatus{host: hostname, port: port, isOpened: true, isRTSP: false, banner: string(banner)}
+	return PortStatus{host: hostname, port: port, isOpened: true, isRTSP: false, banner: banner}
 }
 
-// ScanHost performs a port scan on a host for the given ports
-func (s *Scanner) ScanHosts() ([]Stream, error) {
-	var wg sync.WaitGroup
-	results := make(chan PortStatus, len(s.ports))
-
-	for _, host := range s.targets {
-		// Launch goroutine for each port
-		for _, port := range s.ports {
-			var numport int
-			// Parse integer from string
-			_, err := fmt.Sscanf(port, "%d", &numport)
-			if err != nil {
-				fmt.Errorf("Wrong port value:", err)
+// scanJob is a single host and port pair to scan.
+type scanJob struct {
+	host string
+	port int
+}
+
+// scanPorts scans every port of every target host using a bounded pool of
+// workers, and streams the status of each port as soon as it is known.
+// The returned channel is closed once all ports have been scanned, or
+// shortly after the context is canceled.
+func (s *Scanner) scanPorts(ctx context.Context, targets targetSet, ports []int) <-chan PortStatus {
+	jobs := make(chan scanJob)
+	results := make(chan PortStatus)
+
+	// Produce jobs lazily so that memory usage does not depend on the
+	// size of the scanned network.
+	go func() {
+		defer close(jobs)
+		for addr := range targets.hosts() {
+			if s.checkpoint.hostScanned(addr.String()) {
 				continue
 			}
-			wg.Add(1)
-			go isPortOpened("tcp", host, numport, s.timeout, &wg, results)
+			for _, port := range ports {
+				select {
+				case jobs <- scanJob{host: addr.String(), port: port}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range s.scanWorkers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- isPortOpened(ctx, "tcp", job.host, job.port, s.timeout)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// scanWorkers returns the amount of connections that the port scan keeps
+// open concurrently, depending on the scan speed.
+func (s *Scanner) scanWorkers() int {
+	speed := min(max(s.scanSpeed, minScanSpeed), maxScanSpeed)
+	return scanSpeedWorkers[speed]
+}
+
+// parsePorts parses the port list into port numbers.
+func parsePorts(ports []string) ([]int, error) {
+	var parsed []int
+	for _, port := range ports {
+		number, err := strconv.Atoi(strings.TrimSpace(port))
+		if err != nil || number < 1 || number > 65535 {
+			return nil, fmt.Errorf("invalid port %q", port)
 		}
+		parsed = append(parsed, number)
 	}
-	wg.Wait()
-	close(results)
 
-	// Collect results
+	return parsed, nil
+}
+
+// ScanHosts performs a port scan on the targets for the given ports and
+// returns the streams of every port that speaks RTSP.
+func (s *Scanner) ScanHosts() ([]Stream, error) {
+	return s.ScanHostsContext(context.Background())
+}
+
+// ScanHostsContext is like ScanHosts, but stops scanning when the context is
+// canceled, in which case the streams found until then are returned along
+// with the context's error. When resuming from a checkpoint, the hosts that
+// were already scanned are skipped and the streams found on them are
+// returned along with the new ones.
+func (s *Scanner) ScanHostsContext(ctx context.Context) ([]Stream, error) {
+	streams := s.checkpoint.streams()
+	if s.checkpoint.scanDone() {
+		return streams, nil
+	}
+
+	targets, err := parseTargets(ctx, s.targets)
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := parsePorts(s.ports)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.checkpoint.autosave(ctx)()
+
+	// A host is scanned once each of its ports is.
+	scannedPorts := make(map[string]int)
+	for result := range s.scanPorts(ctx, targets, ports) {
+		if result.isOpened {
+			s.events.emit(eventPortOpen, Stream{Address: result.host, Port: uint16(result.port)}, event{})
+		}
 
-	var streams []Stream
-	for result := range results {
 		if result.isRTSP {
-			streams = append(streams, Stream{
-				//Device:  port.Service.Product,
+			stream := Stream{
+				Device:         fingerprintServer(result.serverInfo),
 				Address:        result.host,
 				Port:           uint16(result.port),
 				BannerResponse: result.banner,
-			})
+				ServerInfo:     result.serverInfo,
+			}
+			s.events.emit(eventRTSPConfirmed, stream, event{Device: stream.Device, Server: stream.ServerInfo.Server})
+
+			// Hosts whose scan was interrupted are scanned again when resuming.
+			if !slices.ContainsFunc(streams, func(found Stream) bool {
+				return found.Address == stream.Address && found.Port == stream.Port
+			}) {
+				streams = append(streams, stream)
+				s.checkpoint.updateStreams(stream)
+			}
+		}
+
+		// Ports which were not scanned because the scan was
+		// interrupted are reported as closed.
+		if ctx.Err() != nil {
+			continue
+		}
+		scannedPorts[result.host]++
+		if scannedPorts[result.host] == len(ports) {
+			delete(scannedPorts, result.host)
+			s.checkpoint.setHostScanned(result.host)
 		}
 	}
 
-	return streams, nil
+	if ctx.Err() == nil {
+		s.checkpoint.setScanDone()
+	}
+	return streams, ctx.Err()
 }
 
 // New creates a new Cameradar Scanner and applies the given options.
 func New(options ...func(*Scanner)) (*Scanner, error) {
 	scanner := &Scanner{
 		//client:                   gortsplib.Client{},
-		credentialDictionaryPath: defaultCredentialDictionaryPath,
-		routeDictionaryPath:      defaultRouteDictionaryPath,
+		scanSpeed:         defaultScanSpeed,
+		validationWindow:  defaultValidationWindow,
+		validationFrames:  defaultValidationFrames,
+		recordingDuration: defaultRecordingDuration,
+		hostConcurrency:   defaultHostConcurrency,
+		globalConcurrency: defaultGlobalConcurrency,
+		lockoutBackoff:    defaultLockoutBackoff,
 	}
 
 	for _, option := range options {
 		option(scanner)
 	}
 
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" && scanner.credentialDictionaryPath == defaultCredentialDictionaryPath && scanner.routeDictionaryPath == defaultRouteDictionaryPath {
-		fmt.Println("No $GOPATH was found.\nDictionaries may not be loaded properly, please set your $GOPATH to use the default dictionaries.")
-	}
+	scanner.hostConcurrency = max(scanner.hostConcurrency, 1)
+	scanner.scheduler = newAttackScheduler(scanner.hostConcurrency, scanner.globalConcurrency, scanner.attackInterval)
 
 	scanner.credentialDictionaryPath = os.ExpandEnv(scanner.credentialDictionaryPath)
 	scanner.routeDictionaryPath = os.ExpandEnv(scanner.routeDictionaryPath)
 
-	err := scanner.LoadTargets()
+	routeDiscovery, err := parseRouteDiscovery(scanner.routeDiscovery)
+	if err != nil {
+		return nil, err
+	}
+	scanner.routeDiscovery = routeDiscovery
+
+	outputSchema, err := parseOutputSchema(scanner.outputSchema)
+	if err != nil {
+		return nil, err
+	}
+	scanner.outputSchema = outputSchema
+
+	outputFormat, err := parseReportFormat(scanner.outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	scanner.outputFormat = outputFormat
+	if scanner.reportWriter == nil {
+		scanner.reportWriter = newReportWriter(scanner.outputFormat, scanner.outputSchema)
+	}
+
+	redaction, err := parseRedaction(scanner.redaction)
+	if err != nil {
+		return nil, err
+	}
+	scanner.redaction = redaction
+	if scanner.events != nil {
+		scanner.events.redaction = redaction
+	}
+
+	recordingFormat, err := parseRecordingFormat(scanner.recordingFormat)
+	if err != nil {
+		return nil, err
+	}
+	scanner.recordingFormat = recordingFormat
+
+	err = scanner.LoadTargets()
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse target file: %v", err)
 	}
@@ -153,6 +401,16 @@ func New(options ...func(*Scanner)) (*Scanner, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to load credentials dictionary: %v", err)
 	}
+
+	if scanner.checkpointPath != "" {
+		scanner.checkpoint, err = openCheckpoint(scanner.checkpointPath, scanner.resume, scanner.targets, scanner.ports, scanner.credentials)
+		if err != nil {
+			return nil, err
+		}
+	} else if scanner.resume {
+		return nil, errors.New("resuming a scan requires a checkpoint file")
+	}
+
 	fmt.Println("Beginning scan")
 	return scanner, nil
 }
@@ -186,7 +444,7 @@ func WithVerbose(verbose bool) func(s *Scanner) {
 }
 
 // WithCustomCredentials specifies a custom credential dictionary
-// to use for the attacks.
+// to use for the attacks instead of the built-in one.
 func WithCustomCredentials(dictionaryPath string) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.credentialDictionaryPath = dictionaryPath
@@ -194,15 +452,25 @@ func WithCustomCredentials(dictionaryPath string) func(s *Scanner) {
 }
 
 // WithCustomRoutes specifies a custom route dictionary
-// to use for the attacks.
+// to use for the attacks instead of the built-in one.
 func WithCustomRoutes(dictionaryPath string) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.routeDictionaryPath = dictionaryPath
 	}
 }
 
-// WithScanSpeed specifies the speed at which the scan should be executed. Faster
-// means easier to detect, slower has bigger timeout values and is more silent.
+// WithExtendDictionaries specifies whether custom dictionaries extend the
+// built-in ones rather than replacing them. Entries of custom dictionaries
+// are tried first.
+func WithExtendDictionaries(extend bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.extendDictionaries = extend
+	}
+}
+
+// WithScanSpeed specifies the speed at which the scan should be executed, from 1 to 5.
+// Faster means more ports are scanned concurrently, which is easier to detect and
+// uses more file descriptors, slower is more silent.
 func WithScanSpeed(speed int) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.scanSpeed = speed
@@ -218,15 +486,175 @@ func WithAttackInterval(interval time.Duration) func(s *Scanner) {
 	}
 }
 
+// WithHostConcurrency specifies the amount of attack attempts that Cameradar
+// makes at the same time against a single host. The attack interval applies
+// to the attempts against a host, however many there are at the same time.
+func WithHostConcurrency(concurrency int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.hostConcurrency = concurrency
+	}
+}
+
+// WithGlobalConcurrency specifies the amount of attack attempts that
+// Cameradar makes at the same time against all hosts.
+func WithGlobalConcurrency(concurrency int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.globalConcurrency = concurrency
+	}
+}
+
+// WithLockoutBackoff specifies how long Cameradar pauses the attack of a
+// host which starts refusing credential attempts, as cameras that lock
+// accounts out after failed logins do. The pause doubles each time the host
+// refuses attempts again, until the host is considered locked out.
+func WithLockoutBackoff(backoff time.Duration) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.lockoutBackoff = backoff
+	}
+}
+
+// WithRouteDiscovery specifies which routes of each stream Cameradar looks
+// for: the first route found ("first"), every route of the dictionary that
+// exists ("all", the default), or a route for each channel ("per-channel").
+func WithRouteDiscovery(mode string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.routeDiscovery = mode
+	}
+}
+
+// WithOutputSchema specifies the version of the schema of the results
+// written by Write. The first version, which is the default, is an array of
+// streams which hold the results of their first route, and the second one
+// holds the results of every route of each stream.
+func WithOutputSchema(version int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.outputSchema = version
+	}
+}
+
+// WithCheckpoint specifies the file into which Cameradar periodically saves
+// the state of the scan, so that it can be resumed if it gets interrupted.
+func WithCheckpoint(path string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.checkpointPath = path
+	}
+}
+
+// WithResume specifies whether Cameradar resumes the scan saved in the
+// checkpoint file instead of starting a new one. The hosts, phases and
+// credentials that were already attacked are not attacked again.
+func WithResume(resume bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.resume = resume
+	}
+}
+
+// WithOutputFormat specifies the format of the results written by Write:
+// "json" (the default), "csv" or "markdown", where the tabular formats have
+// a row for each route of each stream.
+func WithOutputFormat(format string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.outputFormat = format
+	}
+}
+
+// WithReportWriter specifies a custom writer for the results written by
+// Write, instead of the one of the output format.
+func WithReportWriter(writer ReportWriter) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.reportWriter = writer
+	}
+}
+
+// WithRedaction specifies which credentials are redacted from the results
+// written by Write and from the events: "none" (the default), "passwords",
+// or "all" to redact usernames as well.
+func WithRedaction(mode string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.redaction = mode
+	}
+}
+
+// WithEvents specifies where Cameradar writes each discovery as soon as it
+// is made, as a line of JSON: open ports, confirmed RTSP servers, routes and
+// credentials found, and validated streams.
+func WithEvents(w io.Writer) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.events = newEventWriter(w)
+	}
+}
+
 // WithTimeout specifies the amount of time after which attack requests should
 // timeout. This should be high if the network you are attacking has a poor
-// connectivity or that you are located far away from it.
+// connectivity or that you are located far away from it. Without it, scan
+// and attack requests time out after 10 seconds.
 func WithTimeout(timeout time.Duration) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.timeout = timeout
 	}
 }
 
+// WithValidationWindow specifies how long Cameradar waits for a stream to send
+// access units before considering that it is not available.
+func WithValidationWindow(window time.Duration) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.validationWindow = window
+	}
+}
+
+// WithValidationFrames specifies how many access units need to be decoded
+// for a stream to be considered available. Receiving a keyframe validates
+// the stream regardless of this amount.
+func WithValidationFrames(frames int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.validationFrames = frames
+	}
+}
+
+// WithSnapshots enables saving the first keyframe of each available stream
+// into the given directory: raw Annex-B access units for H264 and H265 streams,
+// and JPEG images for MJPEG streams.
+func WithSnapshots(directory string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.snapshotDir = directory
+	}
+}
+
+// WithRecording enables the recording of each available stream into its own
+// file in the given directory. Files are named after the stream's address,
+// port and route.
+func WithRecording(directory string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.recordingDir = directory
+	}
+}
+
+// WithRecordingFormat specifies the container in which streams are recorded,
+// either "ts" for MPEG-TS, which is the default, or "mp4" for fragmented MP4.
+// File extensions such as ".mp4" are accepted as well.
+func WithRecordingFormat(format string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.recordingFormat = format
+	}
+}
+
+// WithRecordingDuration specifies for how long each stream is recorded.
+// A zero duration means that recordings are only bounded by their size.
+func WithRecordingDuration(duration time.Duration) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.recordingDuration = duration
+	}
+}
+
+// WithRecordingMaxSize specifies the size in bytes after which the recording
+// of a stream stops. A zero size means that recordings are only bounded by
+// their duration.
+func WithRecordingMaxSize(size int64) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.recordingMaxSize = size
+	}
+}
+
 // func WithClient(targets []string) func(s *Scanner) {
 // 	return func(s *Scanner) {
 // 		s.targets = targets
@@ -0,0 +1,147 @@
+package cameradar
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// answerOptions answers the OPTIONS request sent through the connection
+// with the raw response, and closes the connection.
+func answerOptions(t *testing.T, conn net.Conn, response string) {
+	t.Helper()
+	defer conn.Close()
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	line, err := reader.ReadLine()
+	if err != nil {
+		t.Errorf("unable to read request: %v", err)
+		return
+	}
+	if line != "OPTIONS * RTSP/1.0" {
+		t.Errorf("request line = %q, want an OPTIONS request", line)
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Errorf("unable to read request headers: %v", err)
+		return
+	}
+	if header.Get("CSeq") != "1" {
+		t.Errorf("request CSeq = %q, want 1", header.Get("CSeq"))
+	}
+
+	_, _ = conn.Write([]byte(response))
+}
+
+func TestIsPortRTSP(t *testing.T) {
+	longServer := "Hikvision-Webs " + strings.Repeat("x", 300)
+	body := strings.Repeat("b", 200)
+
+	tests := []struct {
+		name     string
+		response string
+		wantRTSP bool
+		wantInfo ServerInfo
+		wantErr  bool
+	}{
+		{
+			name: "response over 256 bytes",
+			response: "RTSP/1.0 200 OK\r\n" +
+				"CSeq: 1\r\n" +
+				"Server: " + longServer + "\r\n" +
+				"Public: OPTIONS, DESCRIBE, SETUP, TEARDOWN, PLAY\r\n" +
+				"Content-Length: 200\r\n" +
+				"\r\n" + body,
+			wantRTSP: true,
+			wantInfo: ServerInfo{
+				StatusCode:    200,
+				StatusMessage: "OK",
+				CSeq:          "1",
+				Server:        longServer,
+				Methods:       []string{"OPTIONS", "DESCRIBE", "SETUP", "TEARDOWN", "PLAY"},
+			},
+		},
+		{
+			name: "several Public headers",
+			response: "RTSP/1.0 200 OK\r\n" +
+				"CSeq: 1\r\n" +
+				"Public: OPTIONS,DESCRIBE\r\n" +
+				"Public: SETUP , , PLAY\r\n" +
+				"\r\n",
+			wantRTSP: true,
+			wantInfo: ServerInfo{
+				StatusCode:    200,
+				StatusMessage: "OK",
+				CSeq:          "1",
+				Methods:       []string{"OPTIONS", "DESCRIBE", "SETUP", "PLAY"},
+			},
+		},
+		{
+			name: "several WWW-Authenticate headers",
+			response: "RTSP/1.0 401 Unauthorized\r\n" +
+				"CSeq: 1\r\n" +
+				"Server: Dahua Rtsp Server\r\n" +
+				"WWW-Authenticate: Digest realm=\"Login to 4L0123\", nonce=\"abc\"\r\n" +
+				"WWW-Authenticate: Basic realm=\"Login to 4L0123\"\r\n" +
+				"\r\n",
+			wantRTSP: true,
+			wantInfo: ServerInfo{
+				StatusCode:    401,
+				StatusMessage: "Unauthorized",
+				CSeq:          "1",
+				Server:        "Dahua Rtsp Server",
+				WWWAuthenticate: []string{
+					`Digest realm="Login to 4L0123", nonce="abc"`,
+					`Basic realm="Login to 4L0123"`,
+				},
+			},
+		},
+		{
+			name:     "not RTSP",
+			response: "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n",
+		},
+		{
+			name:     "truncated response",
+			response: "RTSP/1.0 200 OK\r\nCSeq: 1\r\nServ",
+			wantRTSP: true,
+		},
+		{
+			name:     "truncated body",
+			response: "RTSP/1.0 200 OK\r\nCSeq: 1\r\nContent-Length: 10\r\n\r\nab",
+			wantRTSP: true,
+		},
+		{
+			name:    "no response",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				answerOptions(t, server, test.response)
+			}()
+
+			isRTSP, banner, info, err := isPortRTSP(client)
+			<-done
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("isPortRTSP() error = %v, want error: %t", err, test.wantErr)
+			}
+			if isRTSP != test.wantRTSP {
+				t.Errorf("isPortRTSP() = %t, want %t", isRTSP, test.wantRTSP)
+			}
+			if banner != test.response {
+				t.Errorf("isPortRTSP() banner = %q, want %q", banner, test.response)
+			}
+			if !reflect.DeepEqual(info, test.wantInfo) {
+				t.Errorf("isPortRTSP() info = %+v, want %+v", info, test.wantInfo)
+			}
+		})
+	}
+}
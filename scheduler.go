@@ -0,0 +1,100 @@
+package cameradar
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// attackScheduler bounds the amount of attack workers that run at the same
+// time against each host and overall, and spaces the requests that the
+// workers of a host send by the attack interval, however many workers
+// there are.
+type attackScheduler struct {
+	interval time.Duration
+	perHost  int
+	global   chan struct{}
+
+	mutex sync.Mutex
+	hosts map[string]*hostSchedule
+}
+
+// hostSchedule is the schedule of the attacks against a single host.
+type hostSchedule struct {
+	workers chan struct{}
+	// next is the earliest time at which the next request can be sent.
+	next time.Time
+}
+
+func newAttackScheduler(perHost, global int, interval time.Duration) *attackScheduler {
+	return &attackScheduler{
+		interval: interval,
+		perHost:  max(perHost, 1),
+		global:   make(chan struct{}, max(global, 1)),
+		hosts:    make(map[string]*hostSchedule),
+	}
+}
+
+func (a *attackScheduler) host(host string) *hostSchedule {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	schedule, ok := a.hosts[host]
+	if !ok {
+		schedule = &hostSchedule{workers: make(chan struct{}, a.perHost)}
+		a.hosts[host] = schedule
+	}
+	return schedule
+}
+
+// acquire waits until a worker can start attacking the host, and returns
+// the function to call once the worker is done.
+func (a *attackScheduler) acquire(ctx context.Context, host string) (func(), error) {
+	schedule := a.host(host)
+
+	select {
+	case schedule.workers <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case a.global <- struct{}{}:
+	case <-ctx.Done():
+		<-schedule.workers
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-a.global
+		<-schedule.workers
+	}, nil
+}
+
+// wait waits until the next request can be sent to the host.
+func (a *attackScheduler) wait(ctx context.Context, host string) error {
+	schedule := a.host(host)
+
+	a.mutex.Lock()
+	start := time.Now()
+	if schedule.next.After(start) {
+		start = schedule.next
+	}
+	schedule.next = start.Add(a.interval)
+	a.mutex.Unlock()
+
+	return sleep(ctx, time.Until(start))
+}
+
+// pause delays the next request sent to the host by the given duration.
+func (a *attackScheduler) pause(host string, duration time.Duration) {
+	schedule := a.host(host)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	next := time.Now().Add(duration)
+	if next.After(schedule.next) {
+		schedule.next = next
+	}
+}
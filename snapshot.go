@@ -0,0 +1,123 @@
+package cameradar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+)
+
+// snapshotCapture keeps the first keyframe decoded while validating a stream,
+// encoded so that it can be saved as is.
+type snapshotCapture struct {
+	extension string
+	encode    func(au [][]byte) []byte
+
+	once sync.Once
+	data []byte
+	done chan struct{}
+}
+
+// newSnapshotCapture returns a snapshot capture for the format, or nil if
+// keyframes of this format can not be saved.
+func newSnapshotCapture(forma format.Format) *snapshotCapture {
+	capture := &snapshotCapture{done: make(chan struct{})}
+
+	switch forma := forma.(type) {
+	case *format.H264:
+		capture.extension = "h264"
+		capture.encode = func(au [][]byte) []byte {
+			// Make sure that the keyframe can be decoded on its own.
+			if !containsH264NALU(au, h264.NALUTypeSPS) && forma.SPS != nil && forma.PPS != nil {
+				au = append([][]byte{forma.SPS, forma.PPS}, au...)
+			}
+			return annexBMarshal(au)
+		}
+
+	case *format.H265:
+		capture.extension = "h265"
+		capture.encode = func(au [][]byte) []byte {
+			// Make sure that the keyframe can be decoded on its own.
+			if !containsH265NALU(au, h265.NALUType_SPS_NUT) && forma.VPS != nil && forma.SPS != nil && forma.PPS != nil {
+				au = append([][]byte{forma.VPS, forma.SPS, forma.PPS}, au...)
+			}
+			return annexBMarshal(au)
+		}
+
+	case *format.MJPEG:
+		// The access unit of a MJPEG stream is a JPEG image.
+		capture.extension = "jpg"
+		capture.encode = func(au [][]byte) []byte {
+			return append([]byte(nil), au[0]...)
+		}
+
+	default:
+		return nil
+	}
+
+	return capture
+}
+
+// capture keeps the keyframe, if no other keyframe was captured before.
+func (c *snapshotCapture) capture(au [][]byte) {
+	c.once.Do(func() {
+		c.data = c.encode(au)
+		close(c.done)
+	})
+}
+
+// saveSnapshot writes the captured keyframe of a stream into the snapshot
+// directory and stores its path in the stream. It must only be called once
+// the keyframe was captured.
+func (s *Scanner) saveSnapshot(stream *Stream, snapshot *snapshotCapture) {
+	path := filepath.Join(s.snapshotDir, streamFileName(*stream, snapshot.extension))
+
+	err := os.WriteFile(path, snapshot.data, 0o644)
+	if err != nil {
+		fmt.Printf("Unable to save snapshot of %s: %v\n", streamHost(*stream), err)
+		return
+	}
+
+	stream.SnapshotPath = path
+}
+
+func containsH264NALU(au [][]byte, typ h264.NALUType) bool {
+	for _, nalu := range au {
+		if len(nalu) > 0 && h264.NALUType(nalu[0]&0x1F) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func containsH265NALU(au [][]byte, typ h265.NALUType) bool {
+	for _, nalu := range au {
+		if len(nalu) > 0 && h265.NALUType((nalu[0]>>1)&0b111111) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// annexBStartCode precedes each NAL unit in the Annex-B format.
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// annexBMarshal encodes an access unit into the Annex-B byte stream format,
+// which can be read by most video tools.
+func annexBMarshal(au [][]byte) []byte {
+	n := 0
+	for _, nalu := range au {
+		n += len(annexBStartCode) + len(nalu)
+	}
+
+	buf := make([]byte, 0, n)
+	for _, nalu := range au {
+		buf = append(buf, annexBStartCode...)
+		buf = append(buf, nalu...)
+	}
+	return buf
+}
@@ -1,10 +1,8 @@
 package cameradar
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	//gortspclientauth "github.com/bluenviron/gortsplib/v5/pkg/headers"
 )
 
 // PrintStreams prints information on each stream.
@@ -31,14 +29,21 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 		fmt.Printf("\tIP address:\t\t%s\n", stream.Address)
 		fmt.Printf("\tRTSP port:\t\t%d\n", stream.Port)
 
-		// switch stream.AuthenticationType {
-		// case gortspclientauth.AuthBasic:
-		// 	s.term.Infoln("\tAuth type:\t\tbasic")
-		// case gortspclientauth.AuthDigest:
-		// 	s.term.Infoln("\tAuth type:\t\tdigest")
-		// default:
-		// 	s.term.Infoln("\tThis camera does not require authentication")
-		// }
+		switch stream.AuthenticationType {
+		case authBasic:
+			fmt.Println("\tAuth type:\t\tbasic")
+		case authDigest:
+			fmt.Println("\tAuth type:\t\tdigest")
+		case authNone:
+			fmt.Println("\tThis camera does not require authentication")
+		}
+
+		switch stream.LockoutState {
+		case lockoutRateLimited:
+			fmt.Printf("\tLockout:\t\trate limited (%s)\n", stream.LockoutReason)
+		case lockoutLocked:
+			fmt.Printf("\tLockout:\t\tlocked out (%s), not every credential was tried\n", stream.LockoutReason)
+		}
 
 		if stream.CredentialsFound {
 			fmt.Printf("\tUsername:\t\t%s\n", stream.Username)
@@ -51,7 +56,7 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 		fmt.Printf("\tRTSP routes:")
 		if stream.RouteFound {
 			for _, route := range stream.Routes {
-				fmt.Printf("\t\t\t\t/" + route)
+				fmt.Printf("\t\t\t\t/%s", route)
 			}
 		} else {
 			fmt.Println("not found")
@@ -65,25 +70,92 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 	} else if success == 1 {
 		fmt.Printf("Successful attack: one device was accessed")
 	} else {
-		fmt.Printf("Streams were found but none were accessed. They are most likely configured with secure credentials and routes. You can try adding entries to the dictionary or generating your own in order to attempt a bruteforce attack on the cameras.\n", ("\xE2\x9C\x96"))
+		fmt.Printf("Streams were found but none were accessed. They are most likely configured with secure credentials and routes. You can try adding entries to the dictionary or generating your own in order to attempt a bruteforce attack on the cameras.\n")
 	}
 }
 
-func (s *Scanner) Write(wc io.WriteCloser, streams []Stream) error {
-	if wc == nil {
-		return nil
+// Output schema versions. The first version is an array of streams which
+// hold the results of their first route. The second one holds the schema
+// version along with the streams, which hold the results of each route.
+const (
+	outputSchemaV1 = 1
+	outputSchemaV2 = 2
+)
+
+// resultsV2 is the output in the second version of the schema.
+type resultsV2 struct {
+	SchemaVersion int        `json:"schema_version"`
+	Streams       []streamV2 `json:"streams"`
+}
+
+// streamV2 is a stream in the second version of the output schema.
+type streamV2 struct {
+	Device         string        `json:"device"`
+	Address        string        `json:"address"`
+	Port           uint16        `json:"port"`
+	BannerResponse string        `json:"response"`
+	ServerInfo     ServerInfo    `json:"server_info"`
+	RouteBehavior  string        `json:"route_behavior,omitempty"`
+	Available      bool          `json:"available"`
+	LockoutState   string        `json:"lockout_state,omitempty"`
+	LockoutReason  string        `json:"lockout_reason,omitempty"`
+	Routes         []RouteResult `json:"routes"`
+	RecordingPath  string        `json:"recording_path,omitempty"`
+	SkippedTracks  []string      `json:"skipped_tracks,omitempty"`
+}
+
+// parseOutputSchema validates the version of the output schema.
+func parseOutputSchema(version int) (int, error) {
+	switch version {
+	case 0, outputSchemaV1:
+		return outputSchemaV1, nil
+	case outputSchemaV2:
+		return outputSchemaV2, nil
+	default:
+		return 0, fmt.Errorf("unsupported output schema version %d", version)
 	}
-	defer wc.Close()
+}
 
-	jsonData, err := json.MarshalIndent(streams, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshalling results: %w", err)
+// schemaResults returns the streams in the given version of the output schema.
+func schemaResults(streams []Stream, schema int) any {
+	if schema != outputSchemaV2 {
+		// The first version is the streams as they are, whose results
+		// of each route were added to it under route_results.
+		return streams
 	}
 
-	_, err = wc.Write(jsonData)
-	if err != nil {
-		return fmt.Errorf("writing results to file: %w", err)
+	results := resultsV2{
+		SchemaVersion: outputSchemaV2,
+		Streams:       make([]streamV2, 0, len(streams)),
+	}
+	for _, stream := range streams {
+		stream.syncRouteResults()
+		results.Streams = append(results.Streams, streamV2{
+			Device:         stream.Device,
+			Address:        stream.Address,
+			Port:           stream.Port,
+			BannerResponse: stream.BannerResponse,
+			ServerInfo:     stream.ServerInfo,
+			RouteBehavior:  stream.RouteBehavior,
+			Available:      stream.Available,
+			LockoutState:   stream.LockoutState,
+			LockoutReason:  stream.LockoutReason,
+			Routes:         stream.RouteResults,
+			RecordingPath:  stream.RecordingPath,
+			SkippedTracks:  stream.SkippedTracks,
+		})
 	}
-	return nil
+	return results
+}
+
+// Write writes the streams in the report format of the scanner, which is
+// JSON in its output schema unless another format or writer was specified.
+// Credentials are redacted from the report if the scanner redacts them.
+func (s *Scanner) Write(wc io.WriteCloser, streams []Stream) error {
+	if wc == nil {
+		return nil
+	}
+	defer wc.Close()
 
+	return s.reportWriter.WriteReport(wc, redactStreams(streams, s.redaction))
 }
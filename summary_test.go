@@ -0,0 +1,77 @@
+package cameradar
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONReportSchemas(t *testing.T) {
+	streams := []Stream{{
+		Address: "192.168.1.10",
+		Port:    554,
+		Routes:  []string{"ch1", "ch2"},
+		RouteResults: []RouteResult{
+			{Route: "ch1", CredentialsFound: true, Username: "admin", Password: "12345", Available: true},
+			{Route: "ch2"},
+		},
+	}}
+
+	tests := []struct {
+		schema int
+		// routes returns the results of the
+		// routes of the first stream of the report.
+		routes func(report map[string]any) []any
+	}{
+		{
+			schema: outputSchemaV1,
+			routes: func(report map[string]any) []any {
+				routes, _ := report["route_results"].([]any)
+				return routes
+			},
+		},
+		{
+			schema: outputSchemaV2,
+			routes: func(report map[string]any) []any {
+				routes, _ := report["routes"].([]any)
+				return routes
+			},
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := jsonReport{schema: test.schema}.WriteReport(&out, streams)
+		if err != nil {
+			t.Fatalf("WriteReport() in schema %d error = %v", test.schema, err)
+		}
+
+		var stream map[string]any
+		if test.schema == outputSchemaV1 {
+			var report []map[string]any
+			err = json.Unmarshal(out.Bytes(), &report)
+			if err == nil && len(report) == 1 {
+				stream = report[0]
+			}
+		} else {
+			var report struct {
+				SchemaVersion int              `json:"schema_version"`
+				Streams       []map[string]any `json:"streams"`
+			}
+			err = json.Unmarshal(out.Bytes(), &report)
+			if report.SchemaVersion != outputSchemaV2 {
+				t.Errorf("schema_version = %d, want %d", report.SchemaVersion, outputSchemaV2)
+			}
+			if err == nil && len(report.Streams) == 1 {
+				stream = report.Streams[0]
+			}
+		}
+		if err != nil || stream == nil {
+			t.Fatalf("schema %d report %s holds no single stream: %v", test.schema, out.String(), err)
+		}
+
+		routes := test.routes(stream)
+		if len(routes) != 2 {
+			t.Errorf("schema %d report holds %d route results, want 2", test.schema, len(routes))
+		}
+	}
+}
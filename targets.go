@@ -0,0 +1,237 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// targetSpec is a single parsed entry of the target list. It can tell
+// whether it covers an address and enumerate every address it covers.
+type targetSpec interface {
+	contains(addr netip.Addr) bool
+	hosts() iter.Seq[netip.Addr]
+}
+
+// targetSet is a parsed target list, in the order it was given.
+type targetSet []targetSpec
+
+// parseTargets parses each target of the list. Targets can be IPv4 or
+// IPv6 addresses, CIDR blocks and IPv6 prefixes (172.16.100.0/24, fd00::/120),
+// IPv4 octet ranges (192.168.1.140-255, 192.168.2-3.0-255) or hostnames,
+// which are resolved to every one of their A and AAAA records.
+// Empty entries and entries starting with # are ignored, and hostnames that
+// cannot be resolved are skipped with a warning rather than failing the scan.
+func parseTargets(ctx context.Context, targets []string) (targetSet, error) {
+	var set targetSet
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" || strings.HasPrefix(target, "#") {
+			continue
+		}
+
+		spec, err := parseTarget(ctx, target)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, errUnresolvableHost) {
+			fmt.Printf("Skipping target %q: %v\n", target, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %v", target, err)
+		}
+
+		set = append(set, spec)
+	}
+
+	return set, nil
+}
+
+// errUnresolvableHost is returned for hostnames which resolve to no address.
+var errUnresolvableHost = errors.New("unable to resolve host")
+
+func parseTarget(ctx context.Context, target string) (targetSpec, error) {
+	if strings.Contains(target, "/") {
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil {
+			return nil, err
+		}
+		return prefixTarget{prefix: prefix.Masked()}, nil
+	}
+
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return addrListTarget{addrs: []netip.Addr{addr.Unmap()}}, nil
+	}
+
+	if strings.Trim(target, "0123456789.-") == "" {
+		octets, ok := parseOctetRanges(target)
+		if !ok {
+			return nil, fmt.Errorf("malformed IPv4 range")
+		}
+		return octets, nil
+	}
+
+	return resolveHostname(ctx, target)
+}
+
+// parseOctetRanges parses nmap-style IPv4 ranges, in which each octet is
+// either a number or an inclusive range of numbers.
+func parseOctetRanges(target string) (octetRangeTarget, bool) {
+	var octets octetRangeTarget
+
+	parts := strings.Split(target, ".")
+	if len(parts) != 4 {
+		return octets, false
+	}
+
+	for i, part := range parts {
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+
+		first, err := strconv.ParseUint(low, 10, 8)
+		if err != nil {
+			return octets, false
+		}
+		last, err := strconv.ParseUint(high, 10, 8)
+		if err != nil || last < first {
+			return octets, false
+		}
+
+		octets[i] = [2]uint8{uint8(first), uint8(last)}
+	}
+
+	return octets, true
+}
+
+func resolveHostname(ctx context.Context, hostname string) (targetSpec, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", hostname)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnresolvableHost, err)
+	}
+
+	var list addrListTarget
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if !list.contains(addr) {
+			list.addrs = append(list.addrs, addr)
+		}
+	}
+
+	if len(list.addrs) == 0 {
+		return nil, fmt.Errorf("%w: no address found for host %q", errUnresolvableHost, hostname)
+	}
+
+	return list, nil
+}
+
+// hosts lazily enumerates every address covered by the set. An address
+// covered by several targets is only yielded once, for the first target
+// that covers it, so that memory usage does not grow with the amount
+// of enumerated addresses.
+func (t targetSet) hosts() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for i, spec := range t {
+			for addr := range spec.hosts() {
+				if t[:i].contains(addr) {
+					continue
+				}
+				if !yield(addr) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t targetSet) contains(addr netip.Addr) bool {
+	for _, spec := range t {
+		if spec.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixTarget is a CIDR block or an IPv6 prefix.
+type prefixTarget struct {
+	prefix netip.Prefix
+}
+
+func (p prefixTarget) contains(addr netip.Addr) bool {
+	return p.prefix.Contains(addr)
+}
+
+func (p prefixTarget) hosts() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for addr := p.prefix.Addr(); addr.IsValid() && p.prefix.Contains(addr); addr = addr.Next() {
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+// octetRangeTarget is an IPv4 range in which each octet has its own
+// inclusive lower and upper bounds.
+type octetRangeTarget [4][2]uint8
+
+func (o octetRangeTarget) contains(addr netip.Addr) bool {
+	if !addr.Is4() {
+		return false
+	}
+
+	for i, octet := range addr.As4() {
+		if octet < o[i][0] || octet > o[i][1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o octetRangeTarget) hosts() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for a := int(o[0][0]); a <= int(o[0][1]); a++ {
+			for b := int(o[1][0]); b <= int(o[1][1]); b++ {
+				for c := int(o[2][0]); c <= int(o[2][1]); c++ {
+					for d := int(o[3][0]); d <= int(o[3][1]); d++ {
+						if !yield(netip.AddrFrom4([4]byte{byte(a), byte(b), byte(c), byte(d)})) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// addrListTarget is a single address or the addresses a hostname resolved to.
+type addrListTarget struct {
+	addrs []netip.Addr
+}
+
+func (l addrListTarget) contains(addr netip.Addr) bool {
+	for _, a := range l.addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (l addrListTarget) hosts() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, addr := range l.addrs {
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
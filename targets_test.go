@@ -0,0 +1,183 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "single address",
+			target: "192.168.1.10",
+			want:   []string{"192.168.1.10"},
+		},
+		{
+			name:   "CIDR block",
+			target: "192.168.1.0/30",
+			want:   []string{"192.168.1.0", "192.168.1.1", "192.168.1.2", "192.168.1.3"},
+		},
+		{
+			name:   "CIDR block with host bits set",
+			target: "192.168.1.3/31",
+			want:   []string{"192.168.1.2", "192.168.1.3"},
+		},
+		{
+			name:   "last octet range",
+			target: "192.168.1.253-255",
+			want:   []string{"192.168.1.253", "192.168.1.254", "192.168.1.255"},
+		},
+		{
+			name:   "several octet ranges",
+			target: "10.0.1-2.5-6",
+			want:   []string{"10.0.1.5", "10.0.1.6", "10.0.2.5", "10.0.2.6"},
+		},
+		{
+			name:   "IPv6 prefix",
+			target: "fd00::/126",
+			want:   []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"},
+		},
+		{
+			name:   "hostname",
+			target: "localhost",
+			want:   []string{"127.0.0.1"},
+		},
+		{
+			name:    "reversed range",
+			target:  "192.168.1.255-140",
+			wantErr: true,
+		},
+		{
+			name:    "octet out of bounds",
+			target:  "192.168.1.140-256",
+			wantErr: true,
+		},
+		{
+			name:    "missing octet",
+			target:  "192.168.1-2",
+			wantErr: true,
+		},
+		{
+			name:    "empty range bound",
+			target:  "192.168.1.-10",
+			wantErr: true,
+		},
+		{
+			name:    "malformed prefix",
+			target:  "192.168.1.0/33",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := parseTarget(context.Background(), test.target)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseTarget(%q) succeeded, want an error", test.target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTarget(%q) failed: %v", test.target, err)
+			}
+
+			var got []string
+			for addr := range spec.hosts() {
+				got = append(got, addr.String())
+			}
+
+			// Hostnames can resolve to more addresses than the expected ones.
+			for _, want := range test.want {
+				if !slices.Contains(got, want) {
+					t.Errorf("parseTarget(%q) hosts are %v, want %v", test.target, got, test.want)
+				}
+				if !spec.contains(netip.MustParseAddr(want)) {
+					t.Errorf("parseTarget(%q) does not contain %s", test.target, want)
+				}
+			}
+			if test.target != "localhost" && len(got) != len(test.want) {
+				t.Errorf("parseTarget(%q) hosts are %v, want %v", test.target, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTargetsSkipsUnresolvableHosts(t *testing.T) {
+	_, err := parseTarget(context.Background(), "unresolvable.invalid")
+	if !errors.Is(err, errUnresolvableHost) {
+		t.Fatalf("parseTarget of an unresolvable host returned %v, want %v", err, errUnresolvableHost)
+	}
+
+	set, err := parseTargets(context.Background(), []string{"unresolvable.invalid", "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("parseTargets failed: %v", err)
+	}
+	if len(set) != 1 || !set.contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Errorf("parseTargets kept %v, want only 10.0.0.1", set)
+	}
+
+	_, err = parseTargets(context.Background(), []string{"10.0.0.1-0"})
+	if err == nil {
+		t.Error("parseTargets of a malformed range succeeded, want an error")
+	}
+}
+
+func TestTargetSetHostsDeduplicates(t *testing.T) {
+	set, err := parseTargets(context.Background(), []string{
+		"# comment",
+		"10.0.0.0/30",
+		"10.0.0.2-5",
+		"",
+		"10.0.0.5",
+	})
+	if err != nil {
+		t.Fatalf("parseTargets failed: %v", err)
+	}
+
+	var got []string
+	for addr := range set.hosts() {
+		got = append(got, addr.String())
+	}
+
+	want := []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("hosts are %v, want %v", got, want)
+	}
+}
+
+func TestParseOctetRanges(t *testing.T) {
+	tests := []struct {
+		target string
+		want   octetRangeTarget
+		ok     bool
+	}{
+		{target: "1.2.3.4", want: octetRangeTarget{{1, 1}, {2, 2}, {3, 3}, {4, 4}}, ok: true},
+		{target: "192.168.2-3.0-255", want: octetRangeTarget{{192, 192}, {168, 168}, {2, 3}, {0, 255}}, ok: true},
+		{target: "1.2.3", ok: false},
+		{target: "1.2.3.4.5", ok: false},
+		{target: "1.2.3.a", ok: false},
+		{target: "1.2.3.5-4", ok: false},
+		{target: "1.2.3.4-", ok: false},
+		{target: "1.2.3.300", ok: false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseOctetRanges(test.target)
+		if ok != test.ok {
+			t.Errorf("parseOctetRanges(%q) ok is %v, want %v", test.target, ok, test.ok)
+			continue
+		}
+		if ok && got != test.want {
+			t.Errorf("parseOctetRanges(%q) is %v, want %v", test.target, got, test.want)
+		}
+	}
+}
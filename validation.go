@@ -0,0 +1,426 @@
+package cameradar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5"
+	"github.com/bluenviron/gortsplib/v5/pkg/base"
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/gortsplib/v5/pkg/format/rtph264"
+	"github.com/bluenviron/gortsplib/v5/pkg/format/rtph265"
+	"github.com/bluenviron/gortsplib/v5/pkg/format/rtpmjpeg"
+	"github.com/bluenviron/gortsplib/v5/pkg/format/rtpmpeg4audio"
+	"github.com/bluenviron/gortsplib/v5/pkg/format/rtpmpeg4video"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/pion/rtp"
+)
+
+// ValidateStreams tries to setup the stream to validate whether or not it is available.
+func (s *Scanner) ValidateStreams(targets []Stream) []Stream {
+	return s.ValidateStreamsContext(context.Background(), targets)
+}
+
+// ValidateStreamsContext is like ValidateStreams, but stops validating streams
+// when the context is canceled.
+func (s *Scanner) ValidateStreamsContext(ctx context.Context, targets []Stream) []Stream {
+	if s.snapshotDir != "" {
+		err := os.MkdirAll(s.snapshotDir, 0o755)
+		if err != nil {
+			fmt.Printf("Unable to create snapshot directory %q: %v\n", s.snapshotDir, err)
+		}
+	}
+
+	for i := range targets {
+		s.validateRoutes(ctx, &targets[i])
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return targets
+}
+
+// validateRoutes validates each route of the stream with its credentials.
+// The stream is available if one of its routes is, in which case that route
+// is moved first so that it is the one used to access the stream.
+func (s *Scanner) validateRoutes(ctx context.Context, stream *Stream) {
+	stream.syncRouteResults()
+
+	available := -1
+	for i := range stream.RouteResults {
+		result := &stream.RouteResults[i]
+		routeStream := stream.forRoute(*result)
+
+		result.Available = s.validateStream(ctx, &routeStream)
+		result.ValidationCodec = routeStream.ValidationCodec
+		result.FirstFrameDelay = routeStream.FirstFrameDelay
+		result.SnapshotPath = routeStream.SnapshotPath
+		if len(result.Media.Medias) == 0 {
+			result.Media = routeStream.Media
+		}
+		if result.Available {
+			s.events.emit(eventStreamValidated, *stream, event{
+				Device:          stream.Device,
+				Route:           eventRoute(result.Route),
+				Username:        routeStream.Username,
+				Password:        routeStream.Password,
+				ValidationCodec: result.ValidationCodec,
+				FirstFrameDelay: result.FirstFrameDelay,
+			})
+		}
+		if result.Available && available < 0 {
+			available = i
+		}
+
+		if s.scheduler.wait(ctx, stream.Address) != nil {
+			break
+		}
+	}
+
+	stream.setPrimaryRoute(max(available, 0))
+}
+
+// validateStream plays the stream until enough access units, or a keyframe, were
+// decoded within the validation window, in which case the stream is available.
+// The codec that was used and the time it took to receive the first access unit
+// are stored in the stream. If snapshots are enabled, the first keyframe is saved
+// as well.
+func (s *Scanner) validateStream(ctx context.Context, stream *Stream) bool {
+	rawURL := fmt.Sprintf(
+		"rtsp://%s:%s@%s/%s",
+		stream.Username,
+		stream.Password,
+		streamHost(*stream),
+		stream.Route(),
+	)
+	attackURL, err := base.ParseURL(rawURL)
+	if err != nil {
+		fmt.Printf("Url parsing %q failed: %v\n", rawURL, err)
+		return false
+	}
+
+	client := &gortsplib.Client{
+		Scheme: attackURL.Scheme,
+		Host:   attackURL.Host,
+	}
+	// connect to the server
+	closeClient, err := startClient(ctx, client)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer closeClient()
+
+	// find available medias
+	desc, _, err := client.Describe(attackURL)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	// Streams resumed from a checkpoint were attacked without their media.
+	if len(stream.Media.Medias) == 0 {
+		stream.Media = *desc
+	}
+
+	// find the media and format to validate the stream with
+	medi, forma := findValidationFormat(desc)
+	if medi == nil {
+		if s.debug {
+			fmt.Printf("No supported media found for %s\n", streamHost(*stream))
+		}
+		return false
+	}
+
+	// setup RTP -> access unit decoder
+	decode, err := newFrameDecoder(forma)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	// setup a single media
+	_, err = client.Setup(desc.BaseURL, medi, 0, 0)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	frames := newFrameCounter(s.validationFrames)
+
+	var snapshot *snapshotCapture
+	if s.snapshotDir != "" {
+		snapshot = newSnapshotCapture(forma)
+	}
+
+	// called when a RTP packet arrives
+	client.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		// extract access unit from RTP packets
+		au, keyframe, err2 := decode(pkt)
+		if err2 != nil {
+			if !isIncompleteFrame(err2) {
+				log.Printf("ERR: %v", err2)
+			}
+			return
+		}
+
+		if keyframe && snapshot != nil {
+			snapshot.capture(au)
+		}
+
+		frames.add(keyframe)
+	})
+
+	// start playing
+	frames.start()
+	_, err = client.Play(nil)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	clientErr := make(chan error, 1)
+	go func() {
+		clientErr <- client.Wait()
+	}()
+
+	window := time.NewTimer(s.validationWindow)
+	defer window.Stop()
+
+	// When snapshots are enabled, keep playing an available stream
+	// until a keyframe is received or the window elapses.
+	validated := frames.done
+	var captured <-chan struct{}
+	if snapshot != nil {
+		captured = snapshot.done
+	}
+
+	available := false
+	for {
+		select {
+		case <-validated:
+			available = true
+			validated = nil
+			stream.ValidationCodec = forma.Codec()
+			stream.FirstFrameDelay = frames.firstFrameDelay()
+			if captured == nil {
+				return true
+			}
+		case <-captured:
+			captured = nil
+			s.saveSnapshot(stream, snapshot)
+			if available {
+				return true
+			}
+		case <-window.C:
+			if !available && s.debug {
+				fmt.Printf("No frame received from %s within %s\n", streamHost(*stream), s.validationWindow)
+			}
+			return available
+		case err = <-clientErr:
+			fmt.Println(err)
+			return available
+		case <-ctx.Done():
+			return available
+		}
+	}
+}
+
+// findValidationFormat returns the first video format that can be decoded,
+// or the first audio format if the stream has no such video format.
+func findValidationFormat(desc *description.Session) (*description.Media, format.Format) {
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			switch forma.(type) {
+			case *format.H264, *format.H265, *format.MJPEG, *format.MPEG4Video:
+				return medi, forma
+			}
+		}
+	}
+
+	for _, medi := range desc.Medias {
+		if medi.Type == description.MediaTypeAudio && len(medi.Formats) > 0 {
+			return medi, medi.Formats[0]
+		}
+	}
+
+	return nil, nil
+}
+
+// frameDecoder extracts access units from RTP packets, and tells whether
+// each access unit is a keyframe.
+type frameDecoder func(pkt *rtp.Packet) (au [][]byte, keyframe bool, err error)
+
+func newFrameDecoder(forma format.Format) (frameDecoder, error) {
+	switch forma := forma.(type) {
+	case *format.H264:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *rtp.Packet) ([][]byte, bool, error) {
+			au, err := rtpDec.Decode(pkt)
+			if err != nil {
+				return nil, false, err
+			}
+			return au, containsIDR(au), nil
+		}, nil
+
+	case *format.H265:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *rtp.Packet) ([][]byte, bool, error) {
+			au, err := rtpDec.Decode(pkt)
+			if err != nil {
+				return nil, false, err
+			}
+			return au, containsIRAP(au), nil
+		}, nil
+
+	case *format.MJPEG:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *rtp.Packet) ([][]byte, bool, error) {
+			frame, err := rtpDec.Decode(pkt)
+			if err != nil {
+				return nil, false, err
+			}
+			// Every JPEG frame can be decoded on its own.
+			return [][]byte{frame}, true, nil
+		}, nil
+
+	case *format.MPEG4Video:
+		rtpDec, err := forma.CreateDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *rtp.Packet) ([][]byte, bool, error) {
+			frame, err := rtpDec.Decode(pkt)
+			if err != nil {
+				return nil, false, err
+			}
+			return [][]byte{frame}, containsIVOP(frame), nil
+		}, nil
+
+	default:
+		// Audio packets are not decoded, receiving them is enough to know
+		// that the stream is live.
+		return func(pkt *rtp.Packet) ([][]byte, bool, error) {
+			if len(pkt.Payload) == 0 {
+				return nil, false, errEmptyPacket
+			}
+			return [][]byte{pkt.Payload}, false, nil
+		}, nil
+	}
+}
+
+var errEmptyPacket = errors.New("empty RTP packet")
+
+// isIncompleteFrame returns whether the decoding error only means that
+// more RTP packets are needed to decode an access unit.
+func isIncompleteFrame(err error) bool {
+	return errors.Is(err, rtph264.ErrMorePacketsNeeded) ||
+		errors.Is(err, rtph264.ErrNonStartingPacketAndNoPrevious) ||
+		errors.Is(err, rtph265.ErrMorePacketsNeeded) ||
+		errors.Is(err, rtph265.ErrNonStartingPacketAndNoPrevious) ||
+		errors.Is(err, rtpmjpeg.ErrMorePacketsNeeded) ||
+		errors.Is(err, rtpmjpeg.ErrNonStartingPacketAndNoPrevious) ||
+		errors.Is(err, rtpmpeg4video.ErrMorePacketsNeeded) ||
+		errors.Is(err, rtpmpeg4audio.ErrMorePacketsNeeded) ||
+		errors.Is(err, errEmptyPacket)
+}
+
+// containsIDR returns whether the H264 access unit contains a keyframe.
+func containsIDR(au [][]byte) bool {
+	return containsH264NALU(au, h264.NALUTypeIDR)
+}
+
+// containsIRAP returns whether the H265 access unit contains a keyframe,
+// which are the NAL units of types BLA_W_LP (16) to RSV_IRAP_VCL23 (23).
+func containsIRAP(au [][]byte) bool {
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+		typ := (nalu[0] >> 1) & 0x3F
+		if typ >= 16 && typ <= 23 {
+			return true
+		}
+	}
+	return false
+}
+
+// vopStartCode precedes each MPEG-4 Video frame.
+var vopStartCode = []byte{0x00, 0x00, 0x01, 0xB6}
+
+// containsIVOP returns whether the MPEG-4 Video frame contains an intra-coded
+// VOP, whose two first bits after the start code are zero.
+func containsIVOP(frame []byte) bool {
+	i := bytes.Index(frame, vopStartCode)
+	if i < 0 || i+len(vopStartCode) >= len(frame) {
+		return false
+	}
+	return frame[i+len(vopStartCode)]>>6 == 0
+}
+
+// frameCounter counts the access units decoded while validating a stream,
+// and signals once a keyframe or enough access units were received.
+type frameCounter struct {
+	mutex     sync.Mutex
+	wanted    int
+	count     int
+	validated bool
+	started   time.Time
+	first     time.Duration
+	done      chan struct{}
+}
+
+func newFrameCounter(wanted int) *frameCounter {
+	return &frameCounter{
+		wanted: wanted,
+		done:   make(chan struct{}),
+	}
+}
+
+// start marks the moment from which the first frame delay is measured.
+func (f *frameCounter) start() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.started = time.Now()
+}
+
+// add counts a decoded access unit.
+func (f *frameCounter) add(keyframe bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.count == 0 {
+		f.first = time.Since(f.started)
+	}
+	f.count++
+
+	if !f.validated && (keyframe || f.count >= f.wanted) {
+		f.validated = true
+		close(f.done)
+	}
+}
+
+func (f *frameCounter) firstFrameDelay() time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.first
+}
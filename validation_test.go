@@ -0,0 +1,184 @@
+package cameradar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+)
+
+func TestFrameCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		wanted int
+		// keyframes tells whether each frame received is a keyframe.
+		keyframes []bool
+		// wantFrames is the amount of frames after which the stream
+		// is validated, or 0 if it is not.
+		wantFrames int
+	}{
+		{name: "enough frames", wanted: 3, keyframes: []bool{false, false, false, false}, wantFrames: 3},
+		{name: "not enough frames", wanted: 3, keyframes: []bool{false, false}},
+		{name: "first frame is a keyframe", wanted: 3, keyframes: []bool{true, false}, wantFrames: 1},
+		{name: "keyframe before enough frames", wanted: 10, keyframes: []bool{false, false, true}, wantFrames: 3},
+		{name: "keyframe after enough frames", wanted: 2, keyframes: []bool{false, false, true}, wantFrames: 2},
+		{name: "no frame", wanted: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames := newFrameCounter(test.wanted)
+			frames.start()
+
+			validatedAt := 0
+			for i, keyframe := range test.keyframes {
+				frames.add(keyframe)
+				if validatedAt > 0 {
+					continue
+				}
+				select {
+				case <-frames.done:
+					validatedAt = i + 1
+				default:
+				}
+			}
+
+			if validatedAt != test.wantFrames {
+				t.Errorf("stream validated after %d frames, want %d", validatedAt, test.wantFrames)
+			}
+		})
+	}
+}
+
+func TestFrameCounterFirstFrameDelay(t *testing.T) {
+	frames := newFrameCounter(10)
+	frames.start()
+	if delay := frames.firstFrameDelay(); delay != 0 {
+		t.Errorf("firstFrameDelay() = %s before any frame, want 0", delay)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	frames.add(false)
+	first := frames.firstFrameDelay()
+	if first < 20*time.Millisecond {
+		t.Errorf("firstFrameDelay() = %s, want at least 20ms", first)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	frames.add(false)
+	if delay := frames.firstFrameDelay(); delay != first {
+		t.Errorf("firstFrameDelay() = %s after the second frame, want %s", delay, first)
+	}
+}
+
+func TestFindValidationFormat(t *testing.T) {
+	h264 := &format.H264{PayloadTyp: 96}
+	h265 := &format.H265{PayloadTyp: 96}
+	mjpeg := &format.MJPEG{}
+	mpeg4 := &format.MPEG4Video{PayloadTyp: 96}
+	vp8 := &format.VP8{PayloadTyp: 97}
+	g711 := &format.G711{PayloadTyp: 0}
+	opus := &format.Opus{PayloadTyp: 111}
+
+	video := func(formats ...format.Format) *description.Media {
+		return &description.Media{Type: description.MediaTypeVideo, Formats: formats}
+	}
+	audio := func(formats ...format.Format) *description.Media {
+		return &description.Media{Type: description.MediaTypeAudio, Formats: formats}
+	}
+
+	tests := []struct {
+		name      string
+		medias    []*description.Media
+		wantMedia int
+		want      format.Format
+	}{
+		{name: "h264", medias: []*description.Media{video(h264)}, want: h264},
+		{name: "h265", medias: []*description.Media{video(h265)}, want: h265},
+		{name: "mjpeg", medias: []*description.Media{video(mjpeg)}, want: mjpeg},
+		{name: "mpeg-4 video", medias: []*description.Media{video(mpeg4)}, want: mpeg4},
+		{name: "video before audio", medias: []*description.Media{audio(g711), video(h265)}, wantMedia: 1, want: h265},
+		{name: "decodable format of a media", medias: []*description.Media{video(vp8, mjpeg)}, want: mjpeg},
+		{name: "decodable video media", medias: []*description.Media{video(vp8), video(h264)}, wantMedia: 1, want: h264},
+		{name: "audio only", medias: []*description.Media{audio(opus, g711)}, want: opus},
+		{name: "audio without format", medias: []*description.Media{audio(), audio(g711)}, wantMedia: 1, want: g711},
+		{name: "undecodable video and audio", medias: []*description.Media{video(vp8), audio(g711)}, wantMedia: 1, want: g711},
+		{name: "undecodable video", medias: []*description.Media{video(vp8)}, wantMedia: -1},
+		{name: "no media", wantMedia: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			medi, forma := findValidationFormat(&description.Session{Medias: test.medias})
+
+			var wantMedia *description.Media
+			if test.wantMedia >= 0 {
+				wantMedia = test.medias[test.wantMedia]
+			}
+			if medi != wantMedia || forma != test.want {
+				t.Errorf("findValidationFormat() = %v, %T, want %v, %T", medi, forma, wantMedia, test.want)
+			}
+		})
+	}
+}
+
+func TestContainsIRAP(t *testing.T) {
+	// The type of an H265 NAL unit is in the 6 bits following
+	// the first bit of its header.
+	nalu := func(typ byte) []byte {
+		return []byte{typ << 1, 0x01, 0xAF}
+	}
+
+	tests := []struct {
+		name string
+		au   [][]byte
+		want bool
+	}{
+		{name: "BLA_W_LP", au: [][]byte{nalu(16)}, want: true},
+		{name: "IDR_W_RADL", au: [][]byte{nalu(19)}, want: true},
+		{name: "IDR_N_LP", au: [][]byte{nalu(20)}, want: true},
+		{name: "CRA", au: [][]byte{nalu(21)}, want: true},
+		{name: "RSV_IRAP_VCL23", au: [][]byte{nalu(23)}, want: true},
+		{name: "parameter sets and IDR", au: [][]byte{nalu(32), nalu(33), nalu(34), nalu(19)}, want: true},
+		{name: "IDR of another layer", au: [][]byte{{19<<1 | 0x01, 0x01}}, want: true},
+		{name: "TRAIL_R", au: [][]byte{nalu(1)}},
+		{name: "RSV_VCL_N15", au: [][]byte{nalu(15)}},
+		{name: "RSV_VCL24", au: [][]byte{nalu(24)}},
+		{name: "parameter sets", au: [][]byte{nalu(32), nalu(33), nalu(34)}},
+		{name: "empty NAL unit", au: [][]byte{{}, nalu(1)}},
+		{name: "empty access unit"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := containsIRAP(test.au); got != test.want {
+				t.Errorf("containsIRAP(%x) = %t, want %t", test.au, got, test.want)
+			}
+		})
+	}
+}
+
+func TestContainsIVOP(t *testing.T) {
+	// A Video Object Layer header, sent before the VOP of keyframes.
+	vol := []byte{0x00, 0x00, 0x01, 0xB0, 0x01, 0x00, 0x00, 0x01, 0x20, 0x00}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  bool
+	}{
+		{name: "I-VOP", frame: []byte{0x00, 0x00, 0x01, 0xB6, 0x10, 0x60}, want: true},
+		{name: "I-VOP after the VOL header", frame: append(vol, 0x00, 0x00, 0x01, 0xB6, 0x3F, 0x60), want: true},
+		{name: "P-VOP", frame: []byte{0x00, 0x00, 0x01, 0xB6, 0x50, 0x60}},
+		{name: "B-VOP", frame: []byte{0x00, 0x00, 0x01, 0xB6, 0x90, 0x60}},
+		{name: "S-VOP", frame: []byte{0x00, 0x00, 0x01, 0xB6, 0xD0, 0x60}},
+		{name: "truncated after the start code", frame: []byte{0x00, 0x00, 0x01, 0xB6}},
+		{name: "VOL header only", frame: vol},
+		{name: "empty frame"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := containsIVOP(test.frame); got != test.want {
+				t.Errorf("containsIVOP(%x) = %t, want %t", test.frame, got, test.want)
+			}
+		})
+	}
+}